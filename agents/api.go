@@ -2,11 +2,14 @@ package agents
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
 	"github.com/AlexsanderHamir/PromptMesh/shared"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/anthropic"
@@ -17,6 +20,8 @@ import (
 	"github.com/tmc/langchaingo/memory"
 )
 
+// Agent is not safe for concurrent use: a pipeline links it through NextAgent and
+// IsLast, and every call appends to Memory, so concurrent runs build their own agents.
 type Agent struct {
 	Name      string
 	Role      string
@@ -28,6 +33,50 @@ type Agent struct {
 	NextAgent *Agent
 	IsLast    bool
 	Verbose   bool
+
+	// Cache is consulted according to CacheMode; nil disables caching.
+	Cache     Cache
+	CacheMode string
+
+	// OutputSchema, when set, makes the agent answer in JSON validated against it,
+	// re-prompting up to OutputRetries times with the validation error.
+	OutputSchema  map[string]any
+	OutputRetries int
+
+	// Tools the LLM may call; their calls and results are reported through OnEvent.
+	Tools   []Tool
+	OnEvent func(eventType string, data map[string]interface{})
+
+	// Retriever, when set, supplies document chunks injected ahead of the input.
+	Retriever Retriever
+
+	// Limits, when set, queues calls beyond the provider's concurrency and rate limits.
+	Limits *ProviderLimits
+
+	// IsolateInput wraps the input in an escaped data block the LLM is told not
+	// to take instructions from, for inputs produced by upstream agents.
+	IsolateInput bool
+
+	// Pipeline names the pipeline the agent runs in, labelling its metrics.
+	Pipeline string
+
+	// ExecutionID names the execution the agent runs in, tagging its log records.
+	ExecutionID string
+}
+
+// Output is the result of a single Handle call.
+type Output struct {
+	Text   string
+	Cached bool
+
+	// Parsed holds the decoded JSON when the agent has an OutputSchema.
+	Parsed any
+
+	// Parts is the typed form of the response that the next agent receives.
+	Parts []Part
+
+	// Usage sums the tokens of every LLM call behind this output.
+	Usage Usage
 }
 
 func NewAgent(name, role, systemMsg, provider, envVar, model string) (*Agent, error) {
@@ -36,15 +85,61 @@ func NewAgent(name, role, systemMsg, provider, envVar, model string) (*Agent, er
 		return nil, fmt.Errorf("API key not found for provider %s. Please set environment variable %s", provider, envVar)
 	}
 
-	if model == "" {
-		defaultModel, exists := shared.DefaultModels[provider]
-		if exists {
-			model = defaultModel
-		} else {
-			return nil, fmt.Errorf("no default model found for provider: %s", provider)
-		}
+	return NewAgentWithKey(name, role, systemMsg, provider, apiKey, model)
+}
+
+// NewAgentWithKey builds an agent that calls the provider with the caller's own API key.
+func NewAgentWithKey(name, role, systemMsg, provider, apiKey, model string) (*Agent, error) {
+	model, err := resolveModel(provider, model)
+	if err != nil {
+		return nil, err
+	}
+
+	llm, err := newLLM(provider, model, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAgent(name, role, systemMsg, provider, model, llm), nil
+}
+
+// NewReplayAgent builds an agent whose LLM answers from a recorded cassette,
+// so it needs neither an API key nor network access.
+func NewReplayAgent(name, role, systemMsg, provider, model string, cassette *Cassette) (*Agent, error) {
+	model, err := resolveModel(provider, model)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAgent(name, role, systemMsg, provider, model, cassette.Replay()), nil
+}
+
+func newAgent(name, role, systemMsg, provider, model string, llm llms.Model) *Agent {
+	return &Agent{
+		Name:      name,
+		Role:      role,
+		SystemMsg: systemMsg,
+		Provider:  provider,
+		Model:     model,
+		LLM:       llm,
+		Memory:    memory.NewConversationBuffer(),
+		Verbose:   true,
+	}
+}
+
+func resolveModel(provider, model string) (string, error) {
+	if model != "" {
+		return model, nil
 	}
 
+	defaultModel, exists := shared.DefaultModels[provider]
+	if !exists {
+		return "", fmt.Errorf("no default model found for provider: %s", provider)
+	}
+	return defaultModel, nil
+}
+
+func newLLM(provider, model, apiKey string) (llms.Model, error) {
 	var llm llms.Model
 	var err error
 
@@ -83,16 +178,7 @@ func NewAgent(name, role, systemMsg, provider, envVar, model string) (*Agent, er
 		return nil, fmt.Errorf("failed to create %s LLM: %w", provider, err)
 	}
 
-	return &Agent{
-		Name:      name,
-		Role:      role,
-		SystemMsg: systemMsg,
-		Provider:  provider,
-		Model:     model,
-		LLM:       llm,
-		Memory:    memory.NewConversationBuffer(),
-		Verbose:   true,
-	}, nil
+	return llm, nil
 }
 
 // validatePrompt performs comprehensive validation of system message and input
@@ -112,40 +198,174 @@ func (a *Agent) validatePrompt(prompt string) error {
 	return nil
 }
 
-func (a *Agent) Handle(input string) (string, error) {
-	if a.Verbose {
-		fmt.Printf("[%s]: Received input: %s\n", a.Name, input)
-	}
+func (a *Agent) Handle(input []Part) (*Output, error) {
+	return a.HandleContext(context.Background(), input)
+}
+
+// HandleContext is Handle with the caller's context, whose trace the agent's LLM calls join.
+func (a *Agent) HandleContext(ctx context.Context, input []Part) (*Output, error) {
+	start := time.Now()
+	defer func() {
+		metrics.AgentDuration.Observe(time.Since(start).Seconds(), metrics.Pipelines.Value(a.Pipeline), metrics.AgentNames.Value(a.Name), a.Provider)
+	}()
 
-	ctx := context.Background()
+	text := JoinText(input)
+	a.logContent(ctx, "agent received input", "input", text)
 
-	prompt := a.SystemMsg + "\n" + input
+	ctx = withCallCount(ctx)
+
+	prompt, err := a.buildPrompt(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] retrieval failed: %w", a.Name, err)
+	}
 	if err := a.validatePrompt(prompt); err != nil {
-		return "", fmt.Errorf("[%s] prompt validation failed: %w", a.Name, err)
+		return nil, fmt.Errorf("[%s] prompt validation failed: %w", a.Name, err)
+	}
+
+	images := a.imageContent(input)
+
+	var output *Output
+	switch {
+	case len(a.Tools) > 0:
+		output, err = a.generateWithTools(ctx, prompt, images)
+	case a.OutputSchema != nil:
+		output, err = a.generateStructured(ctx, prompt, images)
+	default:
+		output, err = a.generate(ctx, prompt, images)
+	}
+	if err != nil {
+		a.logger().WarnContext(ctx, "agent failed", "error", err, "duration_ms", time.Since(start).Milliseconds())
+		return nil, fmt.Errorf("[%s] %w", a.Name, err)
+	}
+	output.Parts = outputParts(output.Text, output.Parsed)
+	output.Usage = output.Usage.priced(a.Model)
+
+	a.logContent(ctx, "agent responded", "output", output.Text)
+	a.logger().InfoContext(ctx, "agent completed",
+		"model", a.Model,
+		"duration_ms", time.Since(start).Milliseconds(),
+		"prompt_tokens", output.Usage.PromptTokens,
+		"completion_tokens", output.Usage.CompletionTokens,
+		"cached", output.Cached,
+		"last", a.IsLast,
+	)
+
+	err = a.Memory.SaveContext(ctx, map[string]any{"input": text}, map[string]any{"output": output.Text})
+	if err != nil {
+		return nil, fmt.Errorf("[%s] memory error: %w", a.Name, err)
+	}
+
+	// The orchestration layer handles the flow between agents
+	// This agent just returns its response
+	return output, nil
+}
+
+// buildPrompt joins the system message, any retrieved context, and the input.
+func (a *Agent) buildPrompt(ctx context.Context, input string) (string, error) {
+	body := input
+	if a.IsolateInput {
+		body = dataBlock(input)
+	}
+
+	if a.Retriever == nil {
+		return a.SystemMsg + "\n" + body, nil
+	}
+
+	chunks, err := a.Retriever.Retrieve(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(a.SystemMsg)
+	b.WriteString("\n\n--- RETRIEVED CONTEXT ---\n")
+	for _, chunk := range chunks {
+		b.WriteString(chunk)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("--- END RETRIEVED CONTEXT ---\n\n")
+	b.WriteString(body)
+	return b.String(), nil
+}
+
+// generate calls the LLM, going through the cache when the mode allows it.
+func (a *Agent) generate(ctx context.Context, prompt string, images []llms.ContentPart, options ...llms.CallOption) (*Output, error) {
+	useCache := a.Cache != nil && (a.CacheMode == CACHE_READ || a.CacheMode == CACHE_WRITE)
+	message := promptMessage(prompt, images)
+
+	optionsKey, err := callOptionsKey(options)
+	if err != nil {
+		return nil, err
+	}
+	rawMessage, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("cannot key prompt: %w", err)
+	}
+	key := CacheKey(a.Provider, a.Model, optionsKey, string(rawMessage))
+
+	if useCache && a.CacheMode == CACHE_READ && !refreshing(ctx) {
+		if resp, ok := a.Cache.Get(key); ok {
+			return &Output{Text: resp, Cached: true}, nil
+		}
 	}
 
-	resp, err := llms.GenerateFromSinglePrompt(ctx, a.LLM, prompt)
+	resp, err := a.callLLM(ctx, []llms.MessageContent{message}, options...)
 	if err != nil {
-		return "", fmt.Errorf("[%s] LLM error: %w", a.Name, err)
+		return nil, fmt.Errorf("LLM error: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("LLM error: empty response from model")
 	}
+	text := resp.Choices[0].Content
 
-	if a.Verbose {
-		fmt.Printf("[%s]: Responded with: %s\n", a.Name, resp)
+	if useCache {
+		a.Cache.Set(key, text)
 	}
 
-	err = a.Memory.SaveContext(ctx, map[string]any{"input": input}, map[string]any{"output": resp})
+	return &Output{Text: text, Usage: choiceUsage(resp.Choices[0])}, nil
+}
+
+// promptMessage wraps the prompt and any images into one user message.
+func promptMessage(prompt string, images []llms.ContentPart) llms.MessageContent {
+	parts := []llms.ContentPart{llms.TextPart(prompt)}
+	parts = append(parts, images...)
+	return llms.MessageContent{Role: llms.ChatMessageTypeHuman, Parts: parts}
+}
+
+// generateStructured asks for JSON matching OutputSchema, feeding validation
+// errors back to the model until it complies or retries run out.
+func (a *Agent) generateStructured(ctx context.Context, prompt string, images []llms.ContentPart) (*Output, error) {
+	schema, err := json.Marshal(a.OutputSchema)
 	if err != nil {
-		return "", fmt.Errorf("[%s] memory error: %w", a.Name, err)
+		return nil, fmt.Errorf("invalid output schema: %w", err)
 	}
+	prompt += "\n\nRespond only with JSON that matches this JSON Schema:\n" + string(schema)
 
-	if a.IsLast {
-		if a.Verbose {
-			fmt.Printf("[%s]: End of pipeline.\n", a.Name)
+	var options []llms.CallOption
+	if shared.JSONModeProviders[a.Provider] {
+		options = append(options, llms.WithJSONMode())
+	}
+
+	attemptPrompt := prompt
+	var lastErr error
+	var usage Usage
+	for attempt := 0; attempt <= a.OutputRetries; attempt++ {
+		output, err := a.generate(ctx, attemptPrompt, images, options...)
+		if err != nil {
+			return nil, err
+		}
+		usage.Add(output.Usage)
+		output.Usage = usage
+
+		parsed, err := ValidateOutput(a.OutputSchema, output.Text)
+		if err == nil {
+			output.Parsed = parsed
+			return output, nil
 		}
-		return resp, nil
+
+		lastErr = err
+		attemptPrompt = fmt.Sprintf("%s\n\nYour previous response was rejected: %v\nPrevious response:\n%s\n\nTry again.", prompt, err, output.Text)
 	}
 
-	// The orchestration layer handles the flow between agents
-	// This agent just returns its response
-	return resp, nil
+	return nil, fmt.Errorf("output validation failed after %d attempt(s): %w", a.OutputRetries+1, lastErr)
 }
@@ -0,0 +1,190 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Cache modes accepted per request.
+const (
+	CACHE_BYPASS = "bypass" // neither read nor write the cache
+	CACHE_READ   = "read"   // serve hits from the cache, store misses
+	CACHE_WRITE  = "write"  // always call the LLM, store the fresh response
+)
+
+// Cache stores LLM responses keyed by a content hash of the call.
+type Cache interface {
+	Get(key string) (string, bool)
+	Set(key, value string)
+}
+
+type refreshKey struct{}
+
+// WithCacheRefresh makes agents called with ctx skip cache hits, as CACHE_WRITE
+// does, so a rejected response is generated anew and replaced in the cache.
+func WithCacheRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+func refreshing(ctx context.Context) bool {
+	refresh, _ := ctx.Value(refreshKey{}).(bool)
+	return refresh
+}
+
+// CacheKey hashes everything that can change an LLM response.
+func CacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		// Length-prefix each part so ("ab", "c") and ("a", "bc") differ.
+		json.NewEncoder(h).Encode(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// callOptionsKey resolves call options into a stable string for keying.
+func callOptionsKey(options []llms.CallOption) (string, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	raw, err := json.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("cannot key call options: %w", err)
+	}
+	return string(raw), nil
+}
+
+type cacheEntry struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e cacheEntry) expired() bool {
+	return time.Now().After(e.ExpiresAt)
+}
+
+// MemoryCache keeps entries in process memory. Expired entries are dropped when
+// read, and by Sweep for those never read again.
+type MemoryCache struct {
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	mutex   sync.RWMutex
+}
+
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *MemoryCache) Get(key string) (string, bool) {
+	c.mutex.RLock()
+	entry, ok := c.entries[key]
+	c.mutex.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+	if entry.expired() {
+		c.mutex.Lock()
+		// Set may have stored a fresh entry in the meantime
+		if c.entries[key].expired() {
+			delete(c.entries, key)
+		}
+		c.mutex.Unlock()
+		return "", false
+	}
+	return entry.Value, true
+}
+
+// Sweep removes every expired entry.
+func (c *MemoryCache) Sweep() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, entry := range c.entries {
+		if entry.expired() {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *MemoryCache) Set(key, value string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = cacheEntry{Value: value, ExpiresAt: time.Now().Add(c.ttl)}
+}
+
+// DiskCache stores one JSON file per entry so responses survive restarts.
+type DiskCache struct {
+	ttl time.Duration
+	dir string
+}
+
+func NewDiskCache(dir string, ttl time.Duration) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{ttl: ttl, dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (string, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return "", false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.expired() {
+		os.Remove(c.path(key))
+		return "", false
+	}
+	return entry.Value, true
+}
+
+func (c *DiskCache) Set(key, value string) {
+	data, err := json.Marshal(cacheEntry{Value: value, ExpiresAt: time.Now().Add(c.ttl)})
+	if err != nil {
+		return
+	}
+
+	// Write to a temp file first so concurrent readers never see partial JSON.
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	os.Rename(tmp, c.path(key))
+}
+
+// ScopedCache is a view of cache whose entries no other scope can read,
+// for sharing one cache between tenants.
+func ScopedCache(cache Cache, scope string) Cache {
+	return scopedCache{inner: cache, scope: scope}
+}
+
+type scopedCache struct {
+	inner Cache
+	scope string
+}
+
+func (c scopedCache) Get(key string) (string, bool) {
+	return c.inner.Get(CacheKey(c.scope, key))
+}
+
+func (c scopedCache) Set(key, value string) {
+	c.inner.Set(CacheKey(c.scope, key), value)
+}
@@ -0,0 +1,51 @@
+package agents
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScopedCache(t *testing.T) {
+	shared := NewMemoryCache(time.Hour)
+	teamA, teamB := ScopedCache(shared, "team-a"), ScopedCache(shared, "team-b")
+	teamA.Set("prompt", "answer for a")
+	shared.Set("prompt", "answer for everyone")
+
+	tests := []struct {
+		name  string
+		cache Cache
+		want  string
+	}{
+		{name: "own scope", cache: teamA, want: "answer for a"},
+		{name: "other scope", cache: teamB},
+		{name: "unscoped", cache: shared, want: "answer for everyone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.cache.Get("prompt")
+			if ok != (tt.want != "") || got != tt.want {
+				t.Fatalf("got %q (hit: %v), want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheDropsExpiredEntries(t *testing.T) {
+	cache := NewMemoryCache(time.Millisecond)
+	cache.Set("read", "stale")
+	cache.Set("unread", "stale")
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.Get("read"); ok {
+		t.Fatal("served an expired entry")
+	}
+	if _, ok := cache.entries["read"]; ok {
+		t.Fatal("kept an expired entry after reading it")
+	}
+
+	cache.Sweep()
+	if len(cache.entries) != 0 {
+		t.Fatalf("kept %d expired entries after a sweep", len(cache.entries))
+	}
+}
@@ -0,0 +1,154 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Cassette modes accepted per request.
+const (
+	CASSETTE_RECORD = "record"
+	CASSETTE_REPLAY = "replay"
+)
+
+// Interaction is one recorded provider call.
+type Interaction struct {
+	Key      string                `json:"key"`
+	Messages []llms.MessageContent `json:"messages"`
+	Response *llms.ContentResponse `json:"response,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// Cassette holds the provider traffic of one execution, in call order.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	// played counts how many interactions per key were replayed, so repeated
+	// identical calls get their responses back in the order they were recorded.
+	played map[string]int
+	mutex  sync.Mutex
+}
+
+func NewCassette() *Cassette {
+	return &Cassette{played: make(map[string]int)}
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewCassette()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Cassette) Save(path string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Record wraps a model so every call made through it lands on the cassette.
+func (c *Cassette) Record(model llms.Model) llms.Model {
+	return &cassetteModel{cassette: c, inner: model}
+}
+
+// Replay returns a model that answers only from the cassette.
+func (c *Cassette) Replay() llms.Model {
+	return &cassetteModel{cassette: c}
+}
+
+func (c *Cassette) add(interaction Interaction) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+func (c *Cassette) next(key string) (Interaction, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	seen := 0
+	for _, interaction := range c.Interactions {
+		if interaction.Key != key {
+			continue
+		}
+		if seen == c.played[key] {
+			c.played[key]++
+			return interaction, true
+		}
+		seen++
+	}
+	return Interaction{}, false
+}
+
+// cassetteModel records when inner is set and replays otherwise.
+type cassetteModel struct {
+	cassette *Cassette
+	inner    llms.Model
+}
+
+func (m *cassetteModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	key, err := interactionKey(messages, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.inner == nil {
+		return m.replay(key)
+	}
+
+	resp, err := m.inner.GenerateContent(ctx, messages, options...)
+	interaction := Interaction{Key: key, Messages: messages, Response: resp}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	m.cassette.add(interaction)
+
+	return resp, err
+}
+
+func (m *cassetteModel) replay(key string) (*llms.ContentResponse, error) {
+	interaction, ok := m.cassette.next(key)
+	if !ok {
+		return nil, errors.New("no recorded interaction matches this request")
+	}
+	if interaction.Error != "" {
+		return nil, errors.New(interaction.Error)
+	}
+	return interaction.Response, nil
+}
+
+func (m *cassetteModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// interactionKey identifies a call by its messages and resolved call options.
+func interactionKey(messages []llms.MessageContent, options []llms.CallOption) (string, error) {
+	rawMessages, err := json.Marshal(messages)
+	if err != nil {
+		return "", fmt.Errorf("cannot key messages: %w", err)
+	}
+
+	optionsKey, err := callOptionsKey(options)
+	if err != nil {
+		return "", err
+	}
+
+	return CacheKey(string(rawMessages), optionsKey), nil
+}
@@ -0,0 +1,86 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// scriptedModel answers each call with the next reply, or fails once the replies run out.
+type scriptedModel struct {
+	replies []string
+	calls   int
+}
+
+func (m *scriptedModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.calls >= len(m.replies) {
+		return nil, errors.New("provider unavailable")
+	}
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.replies[m.calls-1]}}}, nil
+}
+
+func (m *scriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	provider := &scriptedModel{replies: []string{"first", "second", "other"}}
+
+	cassette := NewCassette()
+	recorder := cassette.Record(provider)
+	for _, prompt := range []string{"hello", "hello", "bye", "fails"} {
+		llms.GenerateFromSinglePrompt(ctx, recorder, prompt, llms.WithTemperature(0))
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := loaded.Replay()
+
+	tests := []struct {
+		name    string
+		prompt  string
+		options []llms.CallOption
+		want    string
+		wantErr string
+	}{
+		{name: "first of repeated calls", prompt: "hello", options: []llms.CallOption{llms.WithTemperature(0)}, want: "first"},
+		{name: "repeated calls in recorded order", prompt: "hello", options: []llms.CallOption{llms.WithTemperature(0)}, want: "second"},
+		{name: "repeated calls exhausted", prompt: "hello", options: []llms.CallOption{llms.WithTemperature(0)}, wantErr: "no recorded interaction matches this request"},
+		{name: "other prompt", prompt: "bye", options: []llms.CallOption{llms.WithTemperature(0)}, want: "other"},
+		{name: "different options", prompt: "bye", options: []llms.CallOption{llms.WithTemperature(1)}, wantErr: "no recorded interaction matches this request"},
+		{name: "recorded error", prompt: "fails", options: []llms.CallOption{llms.WithTemperature(0)}, wantErr: "provider unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := llms.GenerateFromSinglePrompt(ctx, player, tt.prompt, tt.options...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if provider.calls != 3 {
+		t.Fatalf("provider answered %d calls, want 3 recorded ones", provider.calls)
+	}
+}
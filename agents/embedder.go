@@ -0,0 +1,65 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/huggingface"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// Retriever finds context relevant to an agent's input.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string) ([]string, error)
+}
+
+// NewEmbedder builds an embedder for one of the providers in shared.DefaultEmbeddingModels.
+func NewEmbedder(provider, envVar, model string) (embeddings.Embedder, error) {
+	apiKey := os.Getenv(envVar)
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key not found for provider %s. Please set environment variable %s", provider, envVar)
+	}
+
+	if model == "" {
+		defaultModel, exists := shared.DefaultEmbeddingModels[provider]
+		if !exists {
+			return nil, fmt.Errorf("provider %s does not support embeddings", provider)
+		}
+		model = defaultModel
+	}
+
+	var client embeddings.EmbedderClient
+	var err error
+
+	switch provider {
+	case shared.PROVIDER_OPENAI:
+		client, err = openai.New(
+			openai.WithEmbeddingModel(model),
+			openai.WithToken(apiKey),
+		)
+	case shared.PROVIDER_GOOGLEAI:
+		client, err = googleai.New(
+			context.Background(),
+			googleai.WithAPIKey(apiKey),
+			googleai.WithDefaultEmbeddingModel(model),
+		)
+	case shared.PROVIDER_HUGGINGFACE:
+		var llm *huggingface.LLM
+		llm, err = huggingface.New(huggingface.WithToken(apiKey))
+		client = embeddings.EmbedderClientFunc(func(ctx context.Context, texts []string) ([][]float32, error) {
+			return llm.CreateEmbedding(ctx, texts, model, "feature-extraction")
+		})
+	default:
+		return nil, fmt.Errorf("provider %s does not support embeddings", provider)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s embedder: %w", provider, err)
+	}
+
+	return embeddings.NewEmbedder(client)
+}
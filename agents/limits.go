@@ -0,0 +1,141 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
+	"github.com/AlexsanderHamir/PromptMesh/tracing"
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// ProviderLimits bounds the calls made to each provider by every agent sharing it.
+// Providers missing from a map are not limited on that axis.
+type ProviderLimits struct {
+	Concurrency       map[string]int // calls in flight
+	RequestsPerMinute map[string]int
+
+	providers map[string]*providerLimit
+	mutex     sync.Mutex
+}
+
+type providerLimit struct {
+	slots   chan struct{}
+	limiter *rate.Limiter
+}
+
+func (l *ProviderLimits) get(provider string) *providerLimit {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.providers == nil {
+		l.providers = make(map[string]*providerLimit)
+	}
+	limit, ok := l.providers[provider]
+	if !ok {
+		limit = &providerLimit{}
+		if n := l.Concurrency[provider]; n > 0 {
+			limit.slots = make(chan struct{}, n)
+		}
+		if rpm := l.RequestsPerMinute[provider]; rpm > 0 {
+			limit.limiter = rate.NewLimiter(rate.Limit(float64(rpm)/60), 1)
+		}
+		l.providers[provider] = limit
+	}
+	return limit
+}
+
+// callLLM calls the model once the provider's limits allow it, reporting any wait as agent_waiting
+// and the call's tokens or error to the metrics and its trace.
+func (a *Agent) callLLM(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if a.Limits != nil {
+		limit := a.Limits.get(a.Provider)
+
+		// Wait for the rate limit first so no concurrency slot is held idle
+		if limit.limiter != nil {
+			reservation := limit.limiter.Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				a.emitWaiting("rate", delay)
+				metrics.QueueDepth.Inc(a.Provider)
+				select {
+				case <-time.After(delay):
+					metrics.QueueDepth.Dec(a.Provider)
+				case <-ctx.Done():
+					metrics.QueueDepth.Dec(a.Provider)
+					reservation.Cancel()
+					return nil, ctx.Err()
+				}
+			}
+		}
+
+		if limit.slots != nil {
+			select {
+			case limit.slots <- struct{}{}:
+			default:
+				a.emitWaiting("concurrency", 0)
+				metrics.QueueDepth.Inc(a.Provider)
+				select {
+				case limit.slots <- struct{}{}:
+					metrics.QueueDepth.Dec(a.Provider)
+				case <-ctx.Done():
+					metrics.QueueDepth.Dec(a.Provider)
+					return nil, ctx.Err()
+				}
+			}
+			defer func() { <-limit.slots }()
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "llm "+a.Provider, trace.WithAttributes(
+		attribute.String("gen_ai.system", a.Provider),
+		attribute.String("gen_ai.request.model", a.Model),
+		attribute.String("promptmesh.agent", a.Name),
+		attribute.Int("promptmesh.attempt", nextCall(ctx)),
+	))
+	resp, err := a.LLM.GenerateContent(ctx, messages, options...)
+	a.recordCall(resp, err)
+	if err == nil && len(resp.Choices) > 0 {
+		usage := choiceUsage(resp.Choices[0])
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		)
+	}
+	tracing.End(span, err)
+	return resp, err
+}
+
+type callCountKey struct{}
+
+// withCallCount starts numbering the LLM calls made under ctx, so retries show up as later attempts.
+func withCallCount(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callCountKey{}, new(atomic.Int64))
+}
+
+func nextCall(ctx context.Context) int {
+	count, ok := ctx.Value(callCountKey{}).(*atomic.Int64)
+	if !ok {
+		return 1
+	}
+	return int(count.Add(1))
+}
+
+func (a *Agent) emitWaiting(reason string, delay time.Duration) {
+	message := fmt.Sprintf("⏳ Agent '%s' waiting for a free %s slot", a.Name, a.Provider)
+	if reason == "rate" {
+		message = fmt.Sprintf("⏳ Agent '%s' waiting %s for the %s rate limit", a.Name, delay.Round(time.Millisecond), a.Provider)
+	}
+	a.emit("agent_waiting", map[string]interface{}{
+		"agent_name": a.Name,
+		"provider":   a.Provider,
+		"reason":     reason,
+		"wait_ms":    delay.Milliseconds(),
+		"message":    message,
+	})
+}
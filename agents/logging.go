@@ -0,0 +1,43 @@
+package agents
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// LOG_PREVIEW_LENGTH caps, in bytes, the prompt and response text written to debug logs.
+const LOG_PREVIEW_LENGTH = 200
+
+// logger tags the agent's log records with its execution, name and provider.
+func (a *Agent) logger() *slog.Logger {
+	return slog.Default().With("execution_id", a.ExecutionID, "agent", a.Name, "provider", a.Provider)
+}
+
+// logContent writes text at debug level for verbose agents, truncated and with personal data masked.
+func (a *Agent) logContent(ctx context.Context, msg, key, text string) {
+	if !a.Verbose {
+		return
+	}
+	logger := a.logger()
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.DebugContext(ctx, msg, key, logPreview(text), "length", len(text))
+	}
+}
+
+// logPreview masks emails, card and phone numbers and truncates the rest to LOG_PREVIEW_LENGTH.
+func logPreview(text string) string {
+	text = ReplacePII(text, func(kind, _ string) string {
+		return "[" + strings.ToUpper(kind) + "]"
+	})
+	if len(text) <= LOG_PREVIEW_LENGTH {
+		return text
+	}
+
+	cut := LOG_PREVIEW_LENGTH
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "…"
+}
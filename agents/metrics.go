@@ -0,0 +1,65 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Provider error types reported by promptmesh_provider_errors_total.
+const (
+	ERROR_TIMEOUT    = "timeout"
+	ERROR_CANCELED   = "canceled"
+	ERROR_RATE_LIMIT = "rate_limit"
+	ERROR_AUTH       = "auth"
+	ERROR_SERVER     = "server"
+	ERROR_OTHER      = "other"
+)
+
+// recordCall reports the tokens of a provider call, or its error type.
+func (a *Agent) recordCall(resp *llms.ContentResponse, err error) {
+	if err != nil {
+		metrics.ProviderErrors.Inc(metrics.Pipelines.Value(a.Pipeline), a.Provider, errorType(err))
+		return
+	}
+	if len(resp.Choices) == 0 {
+		return
+	}
+	usage := choiceUsage(resp.Choices[0])
+	pipeline, model := metrics.Pipelines.Value(a.Pipeline), metrics.Models.Value(a.Model)
+	metrics.Tokens.Add(float64(usage.PromptTokens), pipeline, a.Provider, model, "prompt")
+	metrics.Tokens.Add(float64(usage.CompletionTokens), pipeline, a.Provider, model, "completion")
+}
+
+// errorType classifies a provider error from its context cause or the status in its message.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ERROR_TIMEOUT
+	case errors.Is(err, context.Canceled):
+		return ERROR_CANCELED
+	}
+
+	message := strings.ToLower(err.Error())
+	contains := func(substrings ...string) bool {
+		for _, substring := range substrings {
+			if strings.Contains(message, substring) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains("429", "rate limit", "quota"):
+		return ERROR_RATE_LIMIT
+	case contains("401", "403", "unauthorized", "api key"):
+		return ERROR_AUTH
+	case contains("500", "502", "503", "504", "overloaded"):
+		return ERROR_SERVER
+	}
+	return ERROR_OTHER
+}
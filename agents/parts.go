@@ -0,0 +1,114 @@
+package agents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	PART_TEXT  = "text"
+	PART_IMAGE = "image"
+	PART_JSON  = "json"
+)
+
+// Part is one typed piece of an agent's input or output.
+type Part struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// Images carry either inline bytes (base64 in JSON) or a URL.
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	URL      string `json:"url,omitempty"`
+
+	JSON any `json:"json,omitempty"`
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PART_TEXT, Text: text}
+}
+
+func ImagePart(mimeType string, data []byte) Part {
+	return Part{Type: PART_IMAGE, MIMEType: mimeType, Data: data}
+}
+
+func ImageURLPart(url string) Part {
+	return Part{Type: PART_IMAGE, URL: url}
+}
+
+func JSONPart(value any) Part {
+	return Part{Type: PART_JSON, JSON: value}
+}
+
+// JoinText flattens the text and JSON parts into the text a prompt is built from.
+func JoinText(parts []Part) string {
+	var texts []string
+	for _, part := range parts {
+		switch part.Type {
+		case PART_TEXT:
+			texts = append(texts, part.Text)
+		case PART_JSON:
+			raw, _ := json.Marshal(part.JSON)
+			texts = append(texts, string(raw))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// HasMedia reports whether any part is more than text.
+func HasMedia(parts []Part) bool {
+	for _, part := range parts {
+		if part.Type != PART_TEXT {
+			return true
+		}
+	}
+	return false
+}
+
+// imageContent converts the image parts to content parts the provider understands.
+// Providers without vision get a text placeholder instead, so the pipeline keeps going.
+func (a *Agent) imageContent(parts []Part) []llms.ContentPart {
+	var content []llms.ContentPart
+	for _, part := range parts {
+		if part.Type != PART_IMAGE {
+			continue
+		}
+
+		switch {
+		case !shared.VisionProviders[a.Provider]:
+			content = append(content, llms.TextPart(fmt.Sprintf("[image omitted: %s cannot view images]", a.Provider)))
+		case part.URL != "":
+			content = append(content, llms.ImageURLPart(part.URL))
+		default:
+			content = append(content, llms.BinaryPart(part.MIMEType, part.Data))
+		}
+	}
+	return content
+}
+
+var dataImagePattern = regexp.MustCompile(`data:(image/[a-z0-9.+-]+);base64,([A-Za-z0-9+/=]+)`)
+
+// outputParts splits a response into parts, lifting inline data-URI images,
+// which is how image-generating chat models return pictures, into image parts
+// so their base64 does not travel on as prompt text. Structured output travels
+// as its JSON part alone, since the text is the same JSON.
+func outputParts(text string, parsed any) []Part {
+	parts := []Part{TextPart(dataImagePattern.ReplaceAllString(text, "[image]"))}
+	if parsed != nil {
+		parts = []Part{JSONPart(parsed)}
+	}
+
+	for _, match := range dataImagePattern.FindAllStringSubmatch(text, -1) {
+		data, err := base64.StdEncoding.DecodeString(match[2])
+		if err == nil {
+			parts = append(parts, ImagePart(match[1], data))
+		}
+	}
+	return parts
+}
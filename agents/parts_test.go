@@ -0,0 +1,38 @@
+package agents
+
+import (
+	"testing"
+)
+
+func TestOutputPartsJoinText(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		parsed any
+		want   string
+		images int
+	}{
+		{name: "text", text: "plain answer", want: "plain answer"},
+		{name: "structured", text: "{\n  \"a\": 1\n}", parsed: map[string]any{"a": 1}, want: `{"a":1}`},
+		{name: "inline image", text: "look data:image/png;base64,aGk= here", want: "look [image] here", images: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := outputParts(tt.text, tt.parsed)
+			if got := JoinText(parts); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			images := 0
+			for _, part := range parts {
+				if part.Type == PART_IMAGE {
+					images++
+				}
+			}
+			if images != tt.images {
+				t.Fatalf("got %d image parts, want %d", images, tt.images)
+			}
+		})
+	}
+}
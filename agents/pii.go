@@ -0,0 +1,79 @@
+package agents
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of personal data ReplacePII detects.
+const (
+	PII_EMAIL = "email"
+	PII_CARD  = "card"
+	PII_PHONE = "phone"
+)
+
+type piiDetector struct {
+	kind    string
+	pattern *regexp.Regexp
+	valid   func(value string) bool
+}
+
+// piiDetectors run in order, so card numbers are taken before they can pass for phone numbers.
+var piiDetectors = []piiDetector{
+	{kind: PII_EMAIL, pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{kind: PII_CARD, pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+	{kind: PII_PHONE, pattern: phonePattern, valid: phoneLength},
+}
+
+// phonePattern only takes numbers written like phone numbers: with a country
+// code, a parenthesized area code, or separated groups ending in four digits,
+// so order numbers, IDs and timestamps are left alone. Trailing four-digit
+// groups are taken too, so longer grouped numbers fail phoneLength whole.
+var phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(\d{2,4}\)[ .-]?\d{3,4}[ .-]?\d{3,4}\b` +
+	`|\+\d{1,3}[ .-]?\d{2,4}(?:[ .-]?\d{2,4}){1,4}\b` +
+	`|\b\d{2,4}[ .-]\d{3,4}[ .-]\d{4}(?:[ .-]\d{4})*\b`)
+
+// phoneLength accepts 7 to 15 digits, the most an international number has.
+func phoneLength(value string) bool {
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// ReplacePII rewrites every email, card number and phone number in text with
+// what replace returns for it.
+func ReplacePII(text string, replace func(kind, value string) string) string {
+	for _, detector := range piiDetectors {
+		text = detector.pattern.ReplaceAllStringFunc(text, func(value string) string {
+			if detector.valid != nil && !detector.valid(value) {
+				return value
+			}
+			return replace(detector.kind, value)
+		})
+	}
+	return text
+}
+
+// luhn reports whether the digits of value pass the card number checksum.
+func luhn(value string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(value)
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,46 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplacePII(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "mail jane.doe@example.com today", want: "mail [EMAIL] today"},
+		{text: "card 4111 1111 1111 1111", want: "card [CARD]"},
+		{text: "card 4111-1111-1111-1111.", want: "card [CARD]."},
+		{text: "call +1 415 555 0100", want: "call [PHONE]"},
+		{text: "call +14155550100", want: "call [PHONE]"},
+		{text: "call +44 20 7946 0958", want: "call [PHONE]"},
+		{text: "call (415) 555-0100", want: "call [PHONE]"},
+		{text: "call 415-555-0100.", want: "call [PHONE]."},
+		{text: "call 415.555.0100", want: "call [PHONE]"},
+		{text: "call 030 1234 5678", want: "call [PHONE]"},
+
+		// Numbers that are not written like phone numbers
+		{text: "order 123456789", want: "order 123456789"},
+		{text: "at 1700000000", want: "at 1700000000"},
+		{text: "id 4155550100", want: "id 4155550100"},
+		{text: "host 192.168.100.200", want: "host 192.168.100.200"},
+		{text: "on 2024-10-18", want: "on 2024-10-18"},
+		{text: "version 1.24.3", want: "version 1.24.3"},
+		{text: "total 1,234,567", want: "total 1,234,567"},
+		{text: "serial 1234 5678 9012 3456", want: "serial 1234 5678 9012 3456"},
+		{text: "card 4111 1111 1111 1112", want: "card 4111 1111 1111 1112"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := ReplacePII(tt.text, func(kind, _ string) string {
+				return "[" + strings.ToUpper(kind) + "]"
+			})
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
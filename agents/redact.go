@@ -0,0 +1,131 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Redactor swaps personal data for placeholders such as [EMAIL_1] on the way to a
+// provider and swaps them back in the response. Its mapping lives only in memory,
+// so one Redactor is shared by the agents of a single execution.
+type Redactor struct {
+	placeholders map[string]string // value -> placeholder
+	values       map[string]string // placeholder -> value
+	counts       map[string]int
+	mutex        sync.Mutex
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+// Wrap returns a model that only ever sees redacted prompts.
+func (r *Redactor) Wrap(model llms.Model) llms.Model {
+	return &redactedModel{redactor: r, inner: model}
+}
+
+// Redact replaces personal data in text, reusing the placeholder of values seen before.
+func (r *Redactor) Redact(text string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return ReplacePII(text, func(kind, value string) string {
+		if placeholder, ok := r.placeholders[value]; ok {
+			return placeholder
+		}
+		r.counts[kind]++
+		placeholder := fmt.Sprintf("[%s_%d]", strings.ToUpper(kind), r.counts[kind])
+		r.placeholders[value] = placeholder
+		r.values[placeholder] = value
+		return placeholder
+	})
+}
+
+// Restore puts the original values back in place of known placeholders.
+func (r *Redactor) Restore(text string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.values) == 0 {
+		return text
+	}
+	var replacements []string
+	for placeholder, value := range r.values {
+		replacements = append(replacements, placeholder, value)
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+type redactedModel struct {
+	redactor *Redactor
+	inner    llms.Model
+}
+
+func (m *redactedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	redacted := make([]llms.MessageContent, len(messages))
+	for i, message := range messages {
+		redacted[i] = llms.MessageContent{Role: message.Role, Parts: make([]llms.ContentPart, len(message.Parts))}
+		for j, part := range message.Parts {
+			redacted[i].Parts[j] = m.redactPart(part)
+		}
+	}
+
+	resp, err := m.inner.GenerateContent(ctx, redacted, options...)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	// Copy the response rather than edit it, since a cassette may hold the original
+	restored := &llms.ContentResponse{Choices: make([]*llms.ContentChoice, len(resp.Choices))}
+	for i, choice := range resp.Choices {
+		c := *choice
+		c.Content = m.redactor.Restore(choice.Content)
+		c.ToolCalls = make([]llms.ToolCall, len(choice.ToolCalls))
+		for j, call := range choice.ToolCalls {
+			c.ToolCalls[j] = m.restoreToolCall(call)
+		}
+		restored.Choices[i] = &c
+	}
+	return restored, nil
+}
+
+func (m *redactedModel) redactPart(part llms.ContentPart) llms.ContentPart {
+	switch p := part.(type) {
+	case llms.TextContent:
+		return llms.TextContent{Text: m.redactor.Redact(p.Text)}
+	case llms.ToolCallResponse:
+		p.Content = m.redactor.Redact(p.Content)
+		return p
+	case llms.ToolCall:
+		if p.FunctionCall != nil {
+			call := *p.FunctionCall
+			call.Arguments = m.redactor.Redact(call.Arguments)
+			p.FunctionCall = &call
+		}
+		return p
+	}
+	return part
+}
+
+// restoreToolCall hands tools the real values; pipeline tools share the redactor, so
+// their nested agents redact the values again before calling a provider.
+func (m *redactedModel) restoreToolCall(call llms.ToolCall) llms.ToolCall {
+	if call.FunctionCall != nil {
+		function := *call.FunctionCall
+		function.Arguments = m.redactor.Restore(function.Arguments)
+		call.FunctionCall = &function
+	}
+	return call
+}
+
+func (m *redactedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
@@ -0,0 +1,145 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// validateSchema checks value against the subset of JSON Schema agents rely on:
+// type, enum, properties, required, additionalProperties and items.
+func validateSchema(schema map[string]any, value any, path string) error {
+	if err := checkType(schema["type"], value, path); err != nil {
+		return err
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !inEnum(enum, value) {
+		return fmt.Errorf("%s: value is not one of the allowed enum values", path)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateObject(schema, v, path)
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if _, present := obj[fmt.Sprint(name)]; !present {
+				return fmt.Errorf("%s: missing required property '%v'", path, name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	for name, fieldValue := range obj {
+		fieldSchema, known := properties[name].(map[string]any)
+		if !known {
+			if schema["additionalProperties"] == false {
+				return fmt.Errorf("%s: unexpected property '%s'", path, name)
+			}
+			continue
+		}
+		if err := validateSchema(fieldSchema, fieldValue, path+"."+name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkType accepts either a single type name or a list of them.
+func checkType(declared any, value any, path string) error {
+	var types []string
+	switch t := declared.(type) {
+	case nil:
+		return nil
+	case string:
+		types = []string{t}
+	case []any:
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+	}
+
+	actual := jsonType(value)
+	for _, name := range types {
+		if name == actual || (name == "number" && actual == "integer") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), actual)
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func inEnum(enum []any, value any) bool {
+	raw, _ := json.Marshal(value)
+	for _, allowed := range enum {
+		candidate, _ := json.Marshal(allowed)
+		if string(candidate) == string(raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseJSONOutput decodes a model response, tolerating a surrounding code fence.
+func parseJSONOutput(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(text, "```")
+	}
+
+	var parsed any
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	return parsed, nil
+}
+
+// ValidateOutput decodes a JSON response and checks it against schema.
+func ValidateOutput(schema map[string]any, text string) (any, error) {
+	parsed, err := parseJSONOutput(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSchema(schema, parsed, "$"); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
@@ -0,0 +1,58 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := map[string]any{
+		"type":                 "object",
+		"required":             []any{"score", "label"},
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"score": map[string]any{"type": "integer"},
+			"label": map[string]any{"type": "string", "enum": []any{"good", "bad"}},
+			"notes": map[string]any{"type": []any{"string", "null"}},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{name: "valid", text: `{"score": 3, "label": "good"}`},
+		{name: "fenced", text: "```json\n{\"score\": 3, \"label\": \"bad\", \"tags\": [\"a\"]}\n```"},
+		{name: "nullable field", text: `{"score": 3, "label": "good", "notes": null}`},
+		{name: "not json", text: `score: 3`, wantErr: "response is not valid JSON"},
+		{name: "wrong root type", text: `[1]`, wantErr: "$: expected object, got array"},
+		{name: "missing required", text: `{"score": 3}`, wantErr: "$: missing required property 'label'"},
+		{name: "not an integer", text: `{"score": 2.5, "label": "good"}`, wantErr: "$.score: expected integer, got number"},
+		{name: "outside enum", text: `{"score": 3, "label": "fine"}`, wantErr: "$.label: value is not one of the allowed enum values"},
+		{name: "unexpected property", text: `{"score": 3, "label": "good", "extra": 1}`, wantErr: "$: unexpected property 'extra'"},
+		{name: "bad item", text: `{"score": 3, "label": "good", "tags": ["a", 1]}`, wantErr: "$.tags[1]: expected string, got integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseJSONOutput(tt.text)
+			if err == nil {
+				err = validateSchema(schema, parsed, "$")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := parsed.(map[string]any); !ok {
+				t.Fatalf("got %T, want a decoded object", parsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// MAX_TOOL_ROUNDS bounds how many times the model may call tools before answering.
+const MAX_TOOL_ROUNDS = 8
+
+// Tool is something the LLM can call while an agent handles its input.
+type Tool interface {
+	Definition() llms.FunctionDefinition
+	Call(ctx context.Context, arguments string) (string, error)
+}
+
+// emit reports an intermediate event to whoever is observing the agent.
+func (a *Agent) emit(eventType string, data map[string]interface{}) {
+	if a.OnEvent != nil {
+		a.OnEvent(eventType, data)
+	}
+}
+
+// generateWithTools runs the tool loop: the model either answers or asks for
+// tool calls, whose results are fed back until it answers.
+func (a *Agent) generateWithTools(ctx context.Context, prompt string, images []llms.ContentPart) (*Output, error) {
+	tools := make(map[string]Tool, len(a.Tools))
+	var definitions []llms.Tool
+	for _, tool := range a.Tools {
+		definition := tool.Definition()
+		tools[definition.Name] = tool
+		definitions = append(definitions, llms.Tool{Type: "function", Function: &definition})
+	}
+
+	messages := []llms.MessageContent{promptMessage(prompt, images)}
+	var usage Usage
+
+	for round := 0; round < MAX_TOOL_ROUNDS; round++ {
+		resp, err := a.callLLM(ctx, messages, llms.WithTools(definitions))
+		if err != nil {
+			return nil, fmt.Errorf("LLM error: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("LLM error: empty response from model")
+		}
+
+		choice := resp.Choices[0]
+		usage.Add(choiceUsage(choice))
+		if len(choice.ToolCalls) == 0 {
+			return &Output{Text: choice.Content, Usage: usage}, nil
+		}
+
+		assistant := llms.MessageContent{Role: llms.ChatMessageTypeAI}
+		for _, call := range choice.ToolCalls {
+			assistant.Parts = append(assistant.Parts, call)
+		}
+		messages = append(messages, assistant)
+
+		for _, call := range choice.ToolCalls {
+			response := llms.ToolCallResponse{ToolCallID: call.ID, Content: a.callTool(ctx, tools, call)}
+			if call.FunctionCall != nil {
+				response.Name = call.FunctionCall.Name
+			}
+			messages = append(messages, llms.MessageContent{
+				Role:  llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{response},
+			})
+		}
+	}
+
+	return nil, fmt.Errorf("no answer after %d tool rounds", MAX_TOOL_ROUNDS)
+}
+
+// callTool runs one tool call; failures are returned to the model as text so it can recover.
+func (a *Agent) callTool(ctx context.Context, tools map[string]Tool, call llms.ToolCall) string {
+	if call.FunctionCall == nil {
+		return "error: tool call without a function"
+	}
+	name, arguments := call.FunctionCall.Name, call.FunctionCall.Arguments
+
+	a.emit("tool_call", map[string]interface{}{
+		"agent_name": a.Name,
+		"tool":       name,
+		"arguments":  arguments,
+		"message":    fmt.Sprintf("🔧 Agent '%s' calling tool '%s'", a.Name, name),
+	})
+
+	var result string
+	tool, ok := tools[name]
+	if !ok {
+		result = fmt.Sprintf("error: unknown tool '%s'", name)
+	} else if out, err := tool.Call(ctx, arguments); err != nil {
+		result = fmt.Sprintf("error: %v", err)
+	} else {
+		result = out
+	}
+
+	a.emit("tool_result", map[string]interface{}{
+		"agent_name": a.Name,
+		"tool":       name,
+		"result":     result,
+		"message":    fmt.Sprintf("📎 Tool '%s' returned %d characters", name, len(result)),
+	})
+
+	return result
+}
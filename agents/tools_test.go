@@ -0,0 +1,86 @@
+package agents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// toolCallingModel asks for its tool calls on the first round and answers with
+// the results it was sent on the second.
+type toolCallingModel struct {
+	calls    []llms.ToolCall
+	received []llms.ToolCallResponse
+}
+
+func (m *toolCallingModel) GenerateContent(_ context.Context, messages []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	if len(messages) == 1 {
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{ToolCalls: m.calls}}}, nil
+	}
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if response, ok := part.(llms.ToolCallResponse); ok {
+				m.received = append(m.received, response)
+			}
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "done"}}}, nil
+}
+
+func (m *toolCallingModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+type echoTool struct{}
+
+func (echoTool) Definition() llms.FunctionDefinition {
+	return llms.FunctionDefinition{Name: "echo"}
+}
+
+func (echoTool) Call(_ context.Context, arguments string) (string, error) {
+	return arguments, nil
+}
+
+func TestGenerateWithToolsReportsBadCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		call llms.ToolCall
+		want llms.ToolCallResponse
+	}{
+		{
+			name: "known tool",
+			call: llms.ToolCall{ID: "1", FunctionCall: &llms.FunctionCall{Name: "echo", Arguments: "hi"}},
+			want: llms.ToolCallResponse{ToolCallID: "1", Name: "echo", Content: "hi"},
+		},
+		{
+			name: "unknown tool",
+			call: llms.ToolCall{ID: "2", FunctionCall: &llms.FunctionCall{Name: "missing"}},
+			want: llms.ToolCallResponse{ToolCallID: "2", Name: "missing", Content: "error: unknown tool 'missing'"},
+		},
+		{
+			name: "no function",
+			call: llms.ToolCall{ID: "3"},
+			want: llms.ToolCallResponse{ToolCallID: "3", Content: "error: tool call without a function"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &toolCallingModel{calls: []llms.ToolCall{tt.call}}
+			agent := newAgent("agent", "", "", "openai", "gpt-4o-mini", model)
+			agent.Tools = []Tool{echoTool{}}
+
+			output, err := agent.Handle([]Part{TextPart("use a tool")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.Text != "done" {
+				t.Fatalf("got %q, want the final answer", output.Text)
+			}
+			if len(model.received) != 1 || model.received[0] != tt.want {
+				t.Fatalf("model received %+v, want %+v", model.received, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package agents
+
+import (
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Usage counts the tokens spent producing an output, as reported by the provider,
+// and their estimated cost.
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CostUSD += other.CostUSD
+}
+
+// priced sets the cost of the tokens at the list price of model.
+func (u Usage) priced(model string) Usage {
+	price := shared.ModelPrices[model]
+	u.CostUSD = (float64(u.PromptTokens)*price.Prompt + float64(u.CompletionTokens)*price.Completion) / 1e6
+	return u
+}
+
+// usageKeys are the generation info keys each provider reports token counts under.
+var usageKeys = [][2]string{
+	{"PromptTokens", "CompletionTokens"}, // openai
+	{"InputTokens", "OutputTokens"},      // anthropic
+	{"input_tokens", "output_tokens"},    // googleai
+}
+
+// choiceUsage reads the token counts of a response choice; providers that
+// report none count as zero.
+func choiceUsage(choice *llms.ContentChoice) Usage {
+	for _, keys := range usageKeys {
+		prompt, ok := toInt(choice.GenerationInfo[keys[0]])
+		if ok {
+			completion, _ := toInt(choice.GenerationInfo[keys[1]])
+			return Usage{PromptTokens: prompt, CompletionTokens: completion}
+		}
+	}
+	return Usage{}
+}
+
+// toInt accepts the integer types providers use, and float64 from replayed cassettes.
+func toInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
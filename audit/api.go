@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// GENESIS_HASH is the previous hash of the first entry.
+const GENESIS_HASH = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// MAX_LINE_SIZE bounds one entry of the log file.
+const MAX_LINE_SIZE = 1 << 20
+
+// Entry records one action. Hash covers every other field, including the
+// previous entry's hash, so editing or removing an entry breaks the chain.
+type Entry struct {
+	Seq         int64     `json:"seq"`
+	Time        time.Time `json:"time"`
+	Actor       string    `json:"actor"`
+	Workspace   string    `json:"workspace"`
+	Action      string    `json:"action"`
+	Pipeline    string    `json:"pipeline,omitempty"`
+	ExecutionID string    `json:"execution_id,omitempty"`
+	Agents      []Agent   `json:"agents,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	PrevHash    string    `json:"prev_hash"`
+	Hash        string    `json:"hash"`
+}
+
+// Agent is an agent an execution ran with.
+type Agent struct {
+	Name       string `json:"name"`
+	Provider   string `json:"provider"`
+	Model      string `json:"model,omitempty"`
+	Credential string `json:"credential,omitempty"`
+}
+
+// Filter selects entries; zero fields match everything.
+type Filter struct {
+	From      time.Time
+	To        time.Time
+	Actor     string
+	Workspace string
+	Pipeline  string
+	Action    string
+}
+
+func (f Filter) matches(entry Entry) bool {
+	return (f.From.IsZero() || !entry.Time.Before(f.From)) &&
+		(f.To.IsZero() || entry.Time.Before(f.To)) &&
+		(f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Workspace == "" || entry.Workspace == f.Workspace) &&
+		(f.Pipeline == "" || entry.Pipeline == f.Pipeline) &&
+		(f.Action == "" || entry.Action == f.Action)
+}
+
+// Log appends entries to a JSONL file, each chained to the one before it.
+type Log struct {
+	path     string
+	seq      int64
+	lastHash string
+	mutex    sync.Mutex
+}
+
+// Open continues the log at path, creating it when missing.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	l := &Log{path: path, lastHash: GENESIS_HASH}
+	err := l.scan(func(entry Entry) error {
+		l.seq, l.lastHash = entry.Seq, entry.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record completes entry with its sequence number, time and hashes and appends it.
+func (l *Log) Record(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry.Seq = l.seq + 1
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.PrevHash = l.lastHash
+	entry.Hash = hash(entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+	return nil
+}
+
+// Query returns the entries matching filter, oldest first.
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	entries := []Entry{}
+	err := l.scan(func(entry Entry) error {
+		if filter.matches(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Verify recomputes the chain and reports the first entry that does not match it.
+func (l *Log) Verify() (int64, error) {
+	prev, seq := GENESIS_HASH, int64(0)
+	err := l.scan(func(entry Entry) error {
+		seq++
+		if entry.Seq != seq || entry.PrevHash != prev || entry.Hash != hash(entry) {
+			return fmt.Errorf("entry %d has been altered or removed", seq)
+		}
+		prev = entry.Hash
+		return nil
+	})
+	return seq, err
+}
+
+// scan calls fn with every entry of the file, holding the lock so no entry is half written.
+func (l *Log) scan(fn func(Entry) error) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_LINE_SIZE)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("invalid audit entry on line %d: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func hash(entry Entry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
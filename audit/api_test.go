@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(lines []string) []string
+		wantErr string
+	}{
+		{name: "intact", tamper: func(lines []string) []string { return lines }},
+		{name: "edited entry", tamper: func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"actor":"key:b"`, `"actor":"key:x"`, 1)
+			return lines
+		}, wantErr: "entry 2 has been altered or removed"},
+		{name: "removed entry", tamper: func(lines []string) []string {
+			return append(lines[:1:1], lines[2:]...)
+		}, wantErr: "entry 2 has been altered or removed"},
+		{name: "reordered entries", tamper: func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, wantErr: "entry 2 has been altered or removed"},
+		{name: "truncated tail", tamper: func(lines []string) []string { return lines[:2] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			log, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, actor := range []string{"key:a", "key:b", "key:c"} {
+				if err := log.Record(Entry{Actor: actor, Action: "pipeline.run"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := log.Verify()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries != int64(len(lines)) {
+				t.Fatalf("verified %d entries, want %d", entries, len(lines))
+			}
+		})
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		log, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Record(Entry{Actor: "key:a", Action: "pipeline.run"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := log.Verify(); err != nil || entries != 2 {
+		t.Fatalf("got %d entries and error %v, want 2 valid entries", entries, err)
+	}
+}
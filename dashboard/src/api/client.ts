@@ -1,5 +1,5 @@
 import { PipelineForm, Agent } from '../types';
-import { API_CONFIG, FILE_SIZES } from '../constants';
+import { API_CONFIG } from '../constants';
 
 interface FileMetadata {
   name: string;
@@ -9,6 +9,7 @@ interface FileMetadata {
 }
 
 interface UploadedFile {
+  file?: File;
   content: string;
   metadata: FileMetadata;
 }
@@ -23,7 +24,6 @@ interface PipelineExecutionRequest {
     provider: string;
     model: string;
   }>;
-  files_metadata: FileMetadata[];
 }
 
 interface PipelineExecutionResponse {
@@ -40,6 +40,7 @@ declare global {
     readonly env: {
       readonly DEV?: boolean;
       readonly VITE_API_URL?: string;
+      readonly VITE_API_KEY?: string;
     };
   }
 }
@@ -48,12 +49,44 @@ const API_BASE_URL = import.meta.env.DEV
   ? API_CONFIG.DEV_API_PATH
   : import.meta.env.VITE_API_URL || `http://${API_CONFIG.DEFAULT_HOST}:${API_CONFIG.DEFAULT_PORT}`;
 
+// Servers with authentication enabled expect an API key with the run scope
+function authHeaders(): Record<string, string> {
+  return import.meta.env.VITE_API_KEY ? { Authorization: `Bearer ${import.meta.env.VITE_API_KEY}` } : {};
+}
+
+function buildPayload(pipelineForm: PipelineForm, agents: Agent[]): PipelineExecutionRequest {
+  return {
+    name: pipelineForm.name,
+    first_prompt: pipelineForm.firstPrompt,
+    agents: [...agents]
+      .sort((a, b) => a.order - b.order) // Ensure agents are sent in correct order
+      .map((agent) => ({
+        name: agent.name,
+        role: agent.role,
+        system_msg: agent.systemMsg,
+        provider: agent.provider,
+        model: agent.model || "",
+      })),
+  };
+}
+
+// The server converts documents to text and passes images to vision models
+function buildMultipartBody(payload: PipelineExecutionRequest, uploadedFiles: UploadedFile[]): FormData {
+  const form = new FormData();
+  form.append("request", JSON.stringify(payload));
+  uploadedFiles.forEach(({ file, content, metadata }) => {
+    form.append("files", file ?? new Blob([content], { type: metadata.mimeType }), metadata.name);
+  });
+  return form;
+}
+
 class ApiClient {
   async request(endpoint: string, options: RequestInit = {}): Promise<any> {
     const url = `${API_BASE_URL}${endpoint}`;
     const config: RequestInit = {
       headers: {
         "Content-Type": "application/json",
+        ...authHeaders(),
         ...options.headers,
       },
       ...options,
@@ -76,68 +109,32 @@ class ApiClient {
     }
   }
 
-  // Enhanced pipeline execution API with file content support
+  // Pipeline execution API; attached files are sent as multipart parts
   async executePipeline(
     pipelineForm: PipelineForm, 
     agents: Agent[], 
     uploadedFiles: UploadedFile[] = []
   ): Promise<PipelineExecutionResponse> {
-    // Process the first prompt to include file content if any
-    let enhancedFirstPrompt = pipelineForm.firstPrompt;
-
-    if (uploadedFiles.length > 0) {
-      let fileContent = "\n\n--- ATTACHED FILES ---\n";
-
-      uploadedFiles.forEach((uploadedFile, index) => {
-        const { content, metadata } = uploadedFile;
-
-        fileContent += `\n--- FILE ${index + 1}: ${metadata.name} ---\n`;
-        fileContent += `File Type: ${metadata.type}\n`;
-        fileContent += `Size: ${(metadata.size / FILE_SIZES.KB).toFixed(2)} KB\n`;
+    const payload = buildPayload(pipelineForm, agents);
 
-        if (metadata.type === "image") {
-          // For images, we need to handle them specially
-          // Most AI models expect specific formats for images
-          if (content.startsWith("data:image")) {
-            fileContent += `Content: [IMAGE - Base64 encoded]\n`;
-            fileContent += `Image Data: ${content}\n`;
-          }
-        } else {
-          fileContent += `Content:\n${content}\n`;
-        }
-
-        fileContent += `--- END FILE ${index + 1} ---\n`;
+    if (uploadedFiles.length === 0) {
+      return this.request("/pipelines/execute", {
+        method: "POST",
+        body: JSON.stringify(payload),
       });
-
-      fileContent += "\n--- END ATTACHED FILES ---\n\n";
-
-      // Add file content to the prompt if not already included
-      if (!enhancedFirstPrompt.includes("--- ATTACHED FILES ---")) {
-        enhancedFirstPrompt += fileContent;
-      }
     }
 
-    return this.request("/pipelines/execute", {
+    // Let the browser set the multipart boundary instead of the JSON content type
+    const response = await fetch(`${API_BASE_URL}/pipelines/execute`, {
       method: "POST",
-      body: JSON.stringify({
-        name: pipelineForm.name,
-        first_prompt: enhancedFirstPrompt,
-        agents: agents.map((agent) => ({
-          name: agent.name,
-          role: agent.role,
-          system_msg: agent.systemMsg,
-          provider: agent.provider,
-          model: agent.model || "",
-        })),
-        // Include file metadata for backend processing if needed
-        files_metadata: uploadedFiles.map((f) => ({
-          name: f.metadata.name,
-          type: f.metadata.type,
-          size: f.metadata.size,
-          mimeType: f.metadata.mimeType,
-        })),
-      }),
+      headers: authHeaders(),
+      body: buildMultipartBody(payload, uploadedFiles),
     });
+    if (!response.ok) {
+      const errorData = await response.json().catch(() => ({}));
+      throw new Error(errorData.error || `HTTP error! status: ${response.status}`);
+    }
+    return response.json();
   }
 
   // Streaming pipeline execution API with Server-Sent Events
@@ -147,69 +144,23 @@ class ApiClient {
     uploadedFiles: UploadedFile[] = [],
     onUpdate?: StreamingCallback
   ): Promise<string> {
-    // Process the first prompt to include file content if any
-    let enhancedFirstPrompt = pipelineForm.firstPrompt;
-
-    if (uploadedFiles.length > 0) {
-      let fileContent = "\n\n--- ATTACHED FILES ---\n";
-
-      uploadedFiles.forEach((uploadedFile, index) => {
-        const { content, metadata } = uploadedFile;
-
-        fileContent += `\n--- FILE ${index + 1}: ${metadata.name} ---\n`;
-        fileContent += `File Type: ${metadata.type}\n`;
-        fileContent += `Size: ${(metadata.size / FILE_SIZES.KB).toFixed(2)} KB\n`;
-
-        if (metadata.type === "image") {
-          // For images, we need to handle them specially
-          // Most AI models expect specific formats for images
-          if (content.startsWith("data:image")) {
-            fileContent += `Content: [IMAGE - Base64 encoded]\n`;
-            fileContent += `Image Data: ${content}\n`;
-          }
-        } else {
-          fileContent += `Content:\n${content}\n`;
-        }
-
-        fileContent += `--- END FILE ${index + 1} ---\n`;
-      });
-
-      fileContent += "\n--- END ATTACHED FILES ---\n\n";
-
-      // Add file content to the prompt if not already included
-      if (!enhancedFirstPrompt.includes("--- ATTACHED FILES ---")) {
-        enhancedFirstPrompt += fileContent;
-      }
-    }
-
-    const payload: PipelineExecutionRequest = {
-      name: pipelineForm.name,
-      first_prompt: enhancedFirstPrompt,
-      agents: agents
-        .sort((a, b) => a.order - b.order) // Ensure agents are sent in correct order
-        .map((agent) => ({
-          name: agent.name,
-          role: agent.role,
-          system_msg: agent.systemMsg,
-          provider: agent.provider,
-          model: agent.model || "",
-        })),
-      files_metadata: uploadedFiles.map((f) => ({
-        name: f.metadata.name,
-        type: f.metadata.type,
-        size: f.metadata.size,
-        mimeType: f.metadata.mimeType,
-      })),
-    };
+    const payload = buildPayload(pipelineForm, agents);
 
     try {
-      const response = await fetch(`${API_BASE_URL}/pipelines/execute/stream`, {
-        method: "POST",
-        headers: {
-          "Content-Type": "application/json",
-        },
-        body: JSON.stringify(payload),
-      });
+      const response = await fetch(`${API_BASE_URL}/pipelines/execute/stream`, uploadedFiles.length === 0
+        ? {
+            method: "POST",
+            headers: {
+              "Content-Type": "application/json",
+              ...authHeaders(),
+            },
+            body: JSON.stringify(payload),
+          }
+        : {
+            method: "POST",
+            headers: authHeaders(),
+            body: buildMultipartBody(payload, uploadedFiles),
+          });
 
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
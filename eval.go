@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/AlexsanderHamir/PromptMesh/server"
+)
+
+// runEval runs an evaluation file, the same JSON POST /api/evaluations takes,
+// prints the report and fails on regressions, or on any failure without a candidate.
+func runEval(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: promptmesh eval <evaluation.json>")
+		return 2
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var req server.EvaluationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ invalid evaluation file: %v\n", err)
+		return 2
+	}
+
+	report, err := server.Evaluate(context.Background(), req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	fmt.Fprintf(os.Stderr, "📊 baseline: %d/%d passed\n", report.Baseline.Passed, report.Baseline.Total)
+	if report.Candidate == nil {
+		if report.Baseline.Passed < report.Baseline.Total {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "📊 candidate: %d/%d passed\n", report.Candidate.Passed, report.Candidate.Total)
+	if len(report.Regressions) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️ regressions: %v\n", report.Regressions)
+		return 1
+	}
+	return 0
+}
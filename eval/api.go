@@ -0,0 +1,296 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/rag"
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+const (
+	ASSERT_CONTAINS    = "contains"
+	ASSERT_REGEX       = "regex"
+	ASSERT_JSON_SCHEMA = "json_schema"
+	ASSERT_EXACT       = "exact"
+	ASSERT_SIMILARITY  = "similarity"
+
+	DEFAULT_SIMILARITY_THRESHOLD = 0.8
+	MAX_JUDGE_SCORE              = 10
+)
+
+// Suite is a set of inputs and what their outputs must satisfy.
+type Suite struct {
+	Name  string `json:"name"`
+	Cases []Case `json:"cases"`
+
+	// MinScore, when set, fails cases the judge scores below it.
+	MinScore float64 `json:"min_score,omitempty"`
+}
+
+type Case struct {
+	Name       string      `json:"name,omitempty"`
+	Input      string      `json:"input"`
+	Assertions []Assertion `json:"assertions,omitempty"`
+}
+
+// Assertion checks an output. Value is the expected text or pattern, Schema
+// applies to json_schema and Threshold to similarity.
+type Assertion struct {
+	Type      string         `json:"type"`
+	Value     string         `json:"value,omitempty"`
+	Schema    map[string]any `json:"schema,omitempty"`
+	Threshold float64        `json:"threshold,omitempty"`
+}
+
+// RunFunc runs one version of a pipeline on an input.
+type RunFunc func(input string) (string, error)
+
+// Evaluator scores outputs. Embedder enables similarity assertions and
+// NewJudge, which builds a fresh judge agent per case, enables judge scoring.
+type Evaluator struct {
+	Embedder embeddings.Embedder
+	NewJudge func() (*agents.Agent, error)
+}
+
+type AssertionResult struct {
+	Type   string `json:"type"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Result is how one pipeline version did on one case.
+type Result struct {
+	Output     string            `json:"output"`
+	Error      string            `json:"error,omitempty"`
+	Passed     bool              `json:"passed"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	Score      *float64          `json:"score,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+}
+
+type CaseReport struct {
+	Name      string  `json:"name"`
+	Input     string  `json:"input"`
+	Baseline  Result  `json:"baseline"`
+	Candidate *Result `json:"candidate,omitempty"`
+}
+
+type Summary struct {
+	Passed       int      `json:"passed"`
+	Total        int      `json:"total"`
+	AverageScore *float64 `json:"average_score,omitempty"`
+}
+
+// Report compares a baseline pipeline with an optional candidate.
+type Report struct {
+	Suite     string       `json:"suite"`
+	Cases     []CaseReport `json:"cases"`
+	Baseline  Summary      `json:"baseline"`
+	Candidate *Summary     `json:"candidate,omitempty"`
+
+	// Regressions names the cases the baseline passes and the candidate fails.
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+// Validate rejects suites that cannot run.
+func (s Suite) Validate() error {
+	if len(s.Cases) == 0 {
+		return errors.New("suite has no cases")
+	}
+	for i, c := range s.Cases {
+		if c.Input == "" {
+			return fmt.Errorf("case %d has no input", i+1)
+		}
+		for _, assertion := range c.Assertions {
+			switch assertion.Type {
+			case ASSERT_CONTAINS, ASSERT_EXACT, ASSERT_JSON_SCHEMA, ASSERT_SIMILARITY:
+			case ASSERT_REGEX:
+				if _, err := regexp.Compile(assertion.Value); err != nil {
+					return fmt.Errorf("case %d: invalid regex: %w", i+1, err)
+				}
+			default:
+				return fmt.Errorf("case %d: unknown assertion type '%s'", i+1, assertion.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Compare runs every case on the baseline and, when given, the candidate.
+func (e *Evaluator) Compare(ctx context.Context, suite Suite, baseline, candidate RunFunc) (*Report, error) {
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Suite: suite.Name}
+	var baselineResults, candidateResults []Result
+
+	for i, c := range suite.Cases {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+
+		caseReport := CaseReport{Name: name, Input: c.Input}
+		caseReport.Baseline = e.run(ctx, suite, c, baseline)
+		baselineResults = append(baselineResults, caseReport.Baseline)
+
+		if candidate != nil {
+			result := e.run(ctx, suite, c, candidate)
+			caseReport.Candidate = &result
+			candidateResults = append(candidateResults, result)
+
+			if caseReport.Baseline.Passed && !result.Passed {
+				report.Regressions = append(report.Regressions, name)
+			}
+		}
+
+		report.Cases = append(report.Cases, caseReport)
+	}
+
+	report.Baseline = summarize(baselineResults)
+	if candidate != nil {
+		summary := summarize(candidateResults)
+		report.Candidate = &summary
+	}
+	return report, nil
+}
+
+// run executes one case on one pipeline version and checks the output.
+func (e *Evaluator) run(ctx context.Context, suite Suite, c Case, run RunFunc) Result {
+	output, err := run(c.Input)
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+
+	result := Result{Output: output, Passed: true}
+	for _, assertion := range c.Assertions {
+		checked := e.check(ctx, assertion, output)
+		result.Assertions = append(result.Assertions, checked)
+		result.Passed = result.Passed && checked.Passed
+	}
+
+	if e.NewJudge != nil {
+		score, reason, err := e.judge(ctx, c.Input, output)
+		if err != nil {
+			// Without a score the case cannot show it meets the minimum
+			result.Reason = fmt.Sprintf("judge failed: %v", err)
+			result.Passed = result.Passed && suite.MinScore <= 0
+		} else {
+			result.Score, result.Reason = &score, reason
+			if suite.MinScore > 0 && score < suite.MinScore {
+				result.Passed = false
+			}
+		}
+	}
+
+	return result
+}
+
+func (e *Evaluator) check(ctx context.Context, assertion Assertion, output string) AssertionResult {
+	result := AssertionResult{Type: assertion.Type}
+
+	switch assertion.Type {
+	case ASSERT_CONTAINS:
+		result.Passed = strings.Contains(output, assertion.Value)
+	case ASSERT_EXACT:
+		result.Passed = strings.TrimSpace(output) == strings.TrimSpace(assertion.Value)
+	case ASSERT_REGEX:
+		result.Passed, _ = regexp.MatchString(assertion.Value, output)
+	case ASSERT_JSON_SCHEMA:
+		if _, err := agents.ValidateOutput(assertion.Schema, output); err != nil {
+			result.Detail = err.Error()
+		} else {
+			result.Passed = true
+		}
+	case ASSERT_SIMILARITY:
+		similarity, err := e.similarity(ctx, assertion.Value, output)
+		if err != nil {
+			result.Detail = err.Error()
+			break
+		}
+		threshold := assertion.Threshold
+		if threshold == 0 {
+			threshold = DEFAULT_SIMILARITY_THRESHOLD
+		}
+		result.Passed = similarity >= threshold
+		result.Detail = fmt.Sprintf("similarity %.3f, threshold %.3f", similarity, threshold)
+	}
+
+	return result
+}
+
+func (e *Evaluator) similarity(ctx context.Context, expected, output string) (float64, error) {
+	if e.Embedder == nil {
+		return 0, errors.New("similarity needs an embedding provider")
+	}
+
+	vectors, err := e.Embedder.EmbedDocuments(ctx, []string{expected, output})
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed: %w", err)
+	}
+	return rag.Cosine(vectors[0], vectors[1]), nil
+}
+
+// judgeSchema is the structured answer asked of the judge agent.
+var judgeSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"score":  map[string]any{"type": "number"},
+		"reason": map[string]any{"type": "string"},
+	},
+	"required": []any{"score", "reason"},
+}
+
+// judge asks a judge agent to score the output; its system message holds the criteria.
+func (e *Evaluator) judge(ctx context.Context, input, output string) (float64, string, error) {
+	judge, err := e.NewJudge()
+	if err != nil {
+		return 0, "", err
+	}
+	judge.OutputSchema = judgeSchema
+
+	prompt := fmt.Sprintf("Score the response to the input from 0 to %d and explain why.\n\nInput:\n%s\n\nResponse:\n%s", MAX_JUDGE_SCORE, input, output)
+	verdict, err := judge.HandleContext(ctx, []agents.Part{agents.TextPart(prompt)})
+	if err != nil {
+		return 0, "", err
+	}
+
+	fields, ok := verdict.Parsed.(map[string]any)
+	if !ok {
+		return 0, "", errors.New("judge did not return a structured verdict")
+	}
+	score, ok := fields["score"].(float64)
+	if !ok {
+		return 0, "", fmt.Errorf("judge returned a non-numeric score: %v", fields["score"])
+	}
+	reason, _ := fields["reason"].(string)
+	return score, reason, nil
+}
+
+func summarize(results []Result) Summary {
+	summary := Summary{Total: len(results)}
+
+	var total float64
+	var scored int
+	for _, result := range results {
+		if result.Passed {
+			summary.Passed++
+		}
+		if result.Score != nil {
+			total += *result.Score
+			scored++
+		}
+	}
+
+	if scored > 0 {
+		average := total / float64(scored)
+		summary.AverageScore = &average
+	}
+	return summary
+}
@@ -0,0 +1,92 @@
+package eval
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// fixedModel gives the same reply to every call.
+type fixedModel struct{ reply string }
+
+func (m fixedModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.reply}}}, nil
+}
+
+func (m fixedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+type noopTool struct{}
+
+func (noopTool) Definition() llms.FunctionDefinition { return llms.FunctionDefinition{Name: "noop"} }
+
+func (noopTool) Call(context.Context, string) (string, error) { return "", nil }
+
+func newJudge(reply string, tools ...agents.Tool) func() (*agents.Agent, error) {
+	return func() (*agents.Agent, error) {
+		agent, err := agents.NewReplayAgent("judge", "judge", "Score helpfulness.", "openai", "gpt-4o-mini", agents.NewCassette())
+		if err != nil {
+			return nil, err
+		}
+		agent.LLM, agent.Tools, agent.Verbose = fixedModel{reply}, tools, false
+		return agent, nil
+	}
+}
+
+func TestCompare(t *testing.T) {
+	suite := Suite{Name: "greetings", MinScore: 5, Cases: []Case{{
+		Input: "Say hello",
+		Assertions: []Assertion{
+			{Type: ASSERT_CONTAINS, Value: "hello"},
+			{Type: ASSERT_REGEX, Value: `^\{`},
+			{Type: ASSERT_JSON_SCHEMA, Schema: map[string]any{"type": "object", "required": []any{"greeting"}}},
+		},
+	}}}
+	baseline := func(string) (string, error) { return `{"greeting": "hello"}`, nil }
+	candidate := func(string) (string, error) { return "hi there", nil }
+
+	tests := []struct {
+		name        string
+		judge       func() (*agents.Agent, error)
+		wantPassed  bool
+		wantScore   float64
+		wantReason  string
+		regressions int
+	}{
+		{name: "no judge", wantPassed: true, regressions: 1},
+		{name: "passing score", judge: newJudge(`{"score": 8, "reason": "friendly"}`), wantPassed: true, wantScore: 8, wantReason: "friendly", regressions: 1},
+		{name: "failing score", judge: newJudge(`{"score": 2, "reason": "curt"}`), wantScore: 2, wantReason: "curt"},
+		{name: "judge with tools", judge: newJudge("plain text", noopTool{}), wantReason: "judge failed: judge did not return a structured verdict"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator := &Evaluator{NewJudge: tt.judge}
+			report, err := evaluator.Compare(context.Background(), suite, baseline, candidate)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := report.Cases[0].Baseline
+			if result.Passed != tt.wantPassed {
+				t.Fatalf("baseline passed: %v, want %v (%+v)", result.Passed, tt.wantPassed, result)
+			}
+			if tt.wantScore != 0 && (result.Score == nil || *result.Score != tt.wantScore) {
+				t.Fatalf("got score %v, want %v", result.Score, tt.wantScore)
+			}
+			if !strings.HasPrefix(result.Reason, tt.wantReason) {
+				t.Fatalf("got reason %q, want %q", result.Reason, tt.wantReason)
+			}
+			if report.Cases[0].Candidate.Passed {
+				t.Fatal("candidate passed without its assertions holding")
+			}
+			if len(report.Regressions) != tt.regressions {
+				t.Fatalf("got regressions %v, want %d", report.Regressions, tt.regressions)
+			}
+		})
+	}
+}
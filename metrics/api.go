@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DURATION_BUCKETS are the upper bounds, in seconds, of the latency histograms.
+var DURATION_BUCKETS = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// The instruments reported on /metrics.
+var (
+	Executions        = NewCounter("promptmesh_executions_total", "Pipeline executions by outcome.", "pipeline", "status")
+	ExecutionDuration = NewHistogram("promptmesh_execution_duration_seconds", "Wall time of pipeline executions.", DURATION_BUCKETS, "pipeline")
+	AgentDuration     = NewHistogram("promptmesh_agent_duration_seconds", "Time an agent takes to answer, including tool calls and retries.", DURATION_BUCKETS, "pipeline", "agent", "provider")
+	ProviderErrors    = NewCounter("promptmesh_provider_errors_total", "Failed provider calls by error type.", "pipeline", "provider", "type")
+	Tokens            = NewCounter("promptmesh_tokens_total", "Tokens spent by provider and model.", "pipeline", "provider", "model", "kind")
+	ActiveStreams     = NewGauge("promptmesh_active_streams", "Server-Sent Event streams currently open.", "pipeline")
+	QueueDepth        = NewGauge("promptmesh_provider_queue_depth", "Provider calls waiting for a rate limit or concurrency slot.", "provider")
+)
+
+// MAX_LABEL_VALUES caps the distinct values of a label callers choose, such as
+// pipeline names; later values are reported as OTHER_LABEL.
+const MAX_LABEL_VALUES = 100
+
+const OTHER_LABEL = "other"
+
+// Caller-chosen label values, bounded so requests cannot create series without limit.
+var (
+	Pipelines  = NewLabelSet(MAX_LABEL_VALUES)
+	AgentNames = NewLabelSet(MAX_LABEL_VALUES)
+	Models     = NewLabelSet(MAX_LABEL_VALUES)
+)
+
+// LabelSet admits the first max distinct values of a label.
+type LabelSet struct {
+	max    int
+	values map[string]bool
+	mutex  sync.Mutex
+}
+
+func NewLabelSet(max int) *LabelSet {
+	return &LabelSet{max: max, values: make(map[string]bool)}
+}
+
+// Value returns value once admitted, or OTHER_LABEL when the set is full.
+func (l *LabelSet) Value(value string) string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.values[value] {
+		if len(l.values) >= l.max {
+			return OTHER_LABEL
+		}
+		l.values[value] = true
+	}
+	return value
+}
+
+var registry struct {
+	metrics []*metric
+	mutex   sync.Mutex
+}
+
+// metric is a family of series sharing a name and label names.
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	mutex   sync.Mutex
+}
+
+type series struct {
+	values []string
+	value  float64  // counters and gauges
+	counts []uint64 // histograms, per bucket
+	sum    float64
+	count  uint64
+}
+
+func register(name, help, kind string, buckets []float64, labels []string) *metric {
+	m := &metric{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = append(registry.metrics, m)
+	return m
+}
+
+// with runs fn on the series of values, creating it on first use; callers pass one value per label.
+func (m *metric) with(values []string, fn func(*series)) {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s takes %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: values, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	fn(s)
+}
+
+// Counter only goes up.
+type Counter struct{ m *metric }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{register(name, help, "counter", nil, labels)}
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	c.m.with(values, func(s *series) { s.value += delta })
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Gauge goes up and down.
+type Gauge struct{ m *metric }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{register(name, help, "gauge", nil, labels)}
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.m.with(values, func(s *series) { s.value += delta })
+}
+
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct{ m *metric }
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{register(name, help, "histogram", buckets, labels)}
+}
+
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.m.with(values, func(s *series) {
+		for i, bound := range h.m.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func WriteText(w io.Writer) error {
+	registry.mutex.Lock()
+	metrics := append([]*metric{}, registry.metrics...)
+	registry.mutex.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *metric) write(b *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, m.labelSet(s.values, ""), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range m.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelSet(s.values, formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, m.labelSet(s.values, "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, m.labelSet(s.values, ""), formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, m.labelSet(s.values, ""), s.count)
+	}
+}
+
+// labelSet renders {name="value",...}, adding le for histogram buckets.
+func (m *metric) labelSet(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", m.labels[i], escape(value)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escape replaces the characters %q would render as \x or \u sequences, which Prometheus rejects.
+func escape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || strconv.IsPrint(r) {
+			return r
+		}
+		return '?'
+	}, value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
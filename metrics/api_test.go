@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelSet(t *testing.T) {
+	labels := NewLabelSet(2)
+	cases := []struct {
+		value string
+		want  string
+	}{
+		{"summarize", "summarize"},
+		{"translate", "translate"},
+		{"classify", OTHER_LABEL},
+		{"summarize", "summarize"},
+		{"", OTHER_LABEL},
+	}
+	for _, c := range cases {
+		if got := labels.Value(c.value); got != c.want {
+			t.Errorf("Value(%q) = %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Requests served.", "pipeline")
+	counter.Inc("a\"b")
+	counter.Add(2, "tab\there")
+	gauge := NewGauge("test_open", "Open streams.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram := NewHistogram("test_seconds", "Durations.", []float64{1, 5}, "pipeline")
+	histogram.Observe(0.5, "p")
+	histogram.Observe(3, "p")
+
+	var b strings.Builder
+	if err := WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	text := b.String()
+
+	cases := []string{
+		"# HELP test_requests_total Requests served.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{pipeline="a\"b"} 1` + "\n",
+		`test_requests_total{pipeline="tab?here"} 2` + "\n",
+		"# TYPE test_open gauge\ntest_open 1\n",
+		`test_seconds_bucket{pipeline="p",le="1"} 1` + "\n",
+		`test_seconds_bucket{pipeline="p",le="5"} 2` + "\n",
+		`test_seconds_bucket{pipeline="p",le="+Inf"} 2` + "\n",
+		`test_seconds_sum{pipeline="p"} 3.5` + "\n",
+		`test_seconds_count{pipeline="p"} 2` + "\n",
+	}
+	for _, want := range cases {
+		if !strings.Contains(text, want) {
+			t.Errorf("output is missing %q:\n%s", want, text)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package orchestration
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/AlexsanderHamir/PromptMesh/agents"
 )
@@ -15,14 +17,68 @@ type AgentManager struct {
 	// but the first agent will receive the intput from the user.
 	FirstPrompt string
 
+	// Attachments, such as images, are handed to the first agent with FirstPrompt.
+	Attachments []agents.Part
+
+	// Variant tags every event when several pipelines share one stream.
+	Variant string
+
+	// Context carries the trace the steps' spans join; nil starts a new trace.
+	Context context.Context
+
 	// Pipeline holds all the agents.
 	pipeline []*agents.Agent
+
+	// Agents whose output must be approved before the pipeline continues,
+	// and the channel a decision arrives on while the execution is parked.
+	approvalSteps map[string]bool
+	decisions     chan ApprovalDecision
+	parked        *agents.Agent
+	executionID   string
+	mutex         sync.Mutex
+
+	// Steps that run nested pipelines, and this pipeline's path when it is nested.
+	subPipelines map[*agents.Agent]*AgentManager
+	mapSteps     map[*agents.Agent]*MapStep
+	path         string
+
+	// usage totals the tokens of every step run so far
+	usage agents.Usage
+
+	// Guardrails validating each step's output, by step name
+	guardrails map[string][]Guardrail
 }
 
 func (ag *AgentManager) AddToPipeline(agent *agents.Agent) {
 	ag.pipeline = append(ag.pipeline, agent)
 }
 
+func (ag *AgentManager) context() context.Context {
+	if ag.Context == nil {
+		return context.Background()
+	}
+	return ag.Context
+}
+
+// Usage is the token usage of the steps run so far, nested pipelines included.
+func (ag *AgentManager) Usage() agents.Usage {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	return ag.usage
+}
+
+func (ag *AgentManager) resetUsage() {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	ag.usage = agents.Usage{}
+}
+
+func (ag *AgentManager) addUsage(usage agents.Usage) {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	ag.usage.Add(usage)
+}
+
 func (ag *AgentManager) connectAgents() {
 	pipelineLength := len(ag.pipeline)
 	lastIndex := pipelineLength - 1
@@ -38,45 +94,70 @@ func (ag *AgentManager) connectAgents() {
 	}
 }
 
-func (ag *AgentManager) StartPipeline() (string, error) {
+// firstInput is what the trigger agent receives: the user's prompt plus attachments.
+func (ag *AgentManager) firstInput() []agents.Part {
+	return append([]agents.Part{agents.TextPart(ag.FirstPrompt)}, ag.Attachments...)
+}
+
+func (ag *AgentManager) StartPipeline() (*agents.Output, error) {
 	ag.connectAgents()
 
 	triggerAgent := ag.pipeline[0]
-	finalRes, err := ag.executePipeline(triggerAgent, ag.FirstPrompt)
+	finalRes, err := ag.executePipeline(triggerAgent, ag.firstInput())
 	if err != nil {
-		return "", fmt.Errorf("pipeline execution failed: %w", err)
+		return nil, fmt.Errorf("pipeline execution failed: %w", err)
 	}
 
 	return finalRes, nil
 }
 
 // executePipeline executes the pipeline step by step without streaming
-func (ag *AgentManager) executePipeline(currentAgent *agents.Agent, input string) (string, error) {
+func (ag *AgentManager) executePipeline(currentAgent *agents.Agent, input []agents.Part) (*agents.Output, error) {
 	if currentAgent == nil {
-		return input, nil
+		return &agents.Output{Text: agents.JoinText(input), Parts: input}, nil
 	}
 
 	// Execute the agent
-	result, err := currentAgent.Handle(input)
+	output, err := ag.handleGuarded(nil, currentAgent, input)
 	if err != nil {
-		return "", fmt.Errorf("agent '%s' failed: %w", currentAgent.Name, err)
+		return nil, fmt.Errorf("agent '%s' failed: %w", currentAgent.Name, err)
 	}
+	ag.addUsage(output.Usage)
 
 	// If this is the last agent, return the result
 	if currentAgent.IsLast {
-		return result, nil
+		return output, nil
 	}
 
 	// Continue with the next agent
-	return ag.executePipeline(currentAgent.NextAgent, result)
+	return ag.executePipeline(currentAgent.NextAgent, output.Parts)
 }
 
 // StartPipelineStream executes the pipeline with streaming updates via SSE
-func (ag *AgentManager) StartPipelineStream(w http.ResponseWriter, executionID string) (string, error) {
+func (ag *AgentManager) StartPipelineStream(w http.ResponseWriter, executionID string) (*agents.Output, error) {
+	ag.executionID = executionID
+
+	finalRes, err := ag.runStream(w, ag.firstInput())
+	if err != nil {
+		return nil, fmt.Errorf("pipeline execution failed: %w", err)
+	}
+
+	return finalRes, nil
+}
+
+// runStream streams the pipeline's steps on input; nested pipelines share the parent's stream
+func (ag *AgentManager) runStream(w http.ResponseWriter, input []agents.Part) (*agents.Output, error) {
 	ag.connectAgents()
 
 	triggerAgent := ag.pipeline[0]
 
+	// Forward intermediate agent events, such as tool calls, to the stream
+	for _, agent := range ag.pipeline {
+		agent.OnEvent = func(eventType string, data map[string]interface{}) {
+			ag.sendAgentUpdate(w, eventType, data)
+		}
+	}
+
 	// Send agent start notification
 	ag.sendAgentUpdate(w, "agent_started", map[string]interface{}{
 		"agent_name": triggerAgent.Name,
@@ -85,31 +166,32 @@ func (ag *AgentManager) StartPipelineStream(w http.ResponseWriter, executionID s
 	})
 
 	// Execute the pipeline with streaming updates
-	finalRes, err := ag.executePipelineWithStreaming(w, triggerAgent, ag.FirstPrompt)
-	if err != nil {
-		return "", fmt.Errorf("pipeline execution failed: %w", err)
-	}
-
-	return finalRes, nil
+	return ag.executePipelineWithStreaming(w, triggerAgent, input)
 }
 
 // executePipelineWithStreaming executes the pipeline step by step with streaming updates
-func (ag *AgentManager) executePipelineWithStreaming(w http.ResponseWriter, currentAgent *agents.Agent, input string) (string, error) {
+func (ag *AgentManager) executePipelineWithStreaming(w http.ResponseWriter, currentAgent *agents.Agent, input []agents.Part) (*agents.Output, error) {
 	if currentAgent == nil {
-		return input, nil
+		return &agents.Output{Text: agents.JoinText(input), Parts: input}, nil
 	}
 
+	inputText := agents.JoinText(input)
+
 	// Send input processing notification
-	ag.sendAgentUpdate(w, "agent_processing", map[string]interface{}{
+	processing := map[string]interface{}{
 		"agent_name":   currentAgent.Name,
 		"agent_role":   currentAgent.Role,
 		"message":      fmt.Sprintf("⚙️ Agent '%s' processing input...", currentAgent.Name),
-		"input_length": len(input),
-		"agent_input":  input, // Include the actual input for observability
-	})
+		"input_length": len(inputText),
+		"agent_input":  inputText, // Include the actual input for observability
+	}
+	if agents.HasMedia(input) {
+		processing["agent_input_parts"] = input
+	}
+	ag.sendAgentUpdate(w, "agent_processing", processing)
 
 	// Execute the agent
-	result, err := currentAgent.Handle(input)
+	output, err := ag.handleGuarded(w, currentAgent, input)
 	if err != nil {
 		// Send error notification
 		ag.sendAgentUpdate(w, "agent_error", map[string]interface{}{
@@ -117,23 +199,40 @@ func (ag *AgentManager) executePipelineWithStreaming(w http.ResponseWriter, curr
 			"agent_role": currentAgent.Role,
 			"message":    fmt.Sprintf("❌ Agent '%s' failed: %v", currentAgent.Name, err),
 		})
-		return "", fmt.Errorf("agent '%s' failed: %w", currentAgent.Name, err)
+		return nil, fmt.Errorf("agent '%s' failed: %w", currentAgent.Name, err)
 	}
+	ag.addUsage(output.Usage)
+
+	result := output.Text
 
 	// Send completion notification with output
-	ag.sendAgentUpdate(w, "agent_completed", map[string]interface{}{
+	completed := map[string]interface{}{
 		"agent_name":    currentAgent.Name,
 		"agent_role":    currentAgent.Role,
 		"message":       fmt.Sprintf("✅ Agent '%s' completed successfully", currentAgent.Name),
 		"output_length": len(result),
 		"is_last":       currentAgent.IsLast,
-		"agent_output":  result, // Include the actual output for observability
-		"agent_input":   input,  // Include the input that was used for this agent
-	})
+		"cached":        output.Cached,
+		"agent_output":  result,    // Include the actual output for observability
+		"agent_input":   inputText, // Include the input that was used for this agent
+	}
+	if output.Parsed != nil {
+		completed["parsed_output"] = output.Parsed
+	}
+	if agents.HasMedia(output.Parts) {
+		completed["agent_output_parts"] = output.Parts
+	}
+	ag.sendAgentUpdate(w, "agent_completed", completed)
+
+	// Park for a human decision when this agent has an approval step
+	output, err = ag.awaitApproval(w, currentAgent, output)
+	if err != nil {
+		return nil, err
+	}
 
 	// If this is the last agent, return the result
 	if currentAgent.IsLast {
-		return result, nil
+		return output, nil
 	}
 
 	// Send handoff notification
@@ -144,18 +243,29 @@ func (ag *AgentManager) executePipelineWithStreaming(w http.ResponseWriter, curr
 	})
 
 	// Continue with the next agent
-	return ag.executePipelineWithStreaming(w, currentAgent.NextAgent, result)
+	return ag.executePipelineWithStreaming(w, currentAgent.NextAgent, output.Parts)
 }
 
 // sendAgentUpdate sends an agent update via SSE
 func (ag *AgentManager) sendAgentUpdate(w http.ResponseWriter, eventType string, data interface{}) {
+	// Events of nested pipelines carry their hierarchical path, e.g. report/summarize
+	if fields, ok := data.(map[string]interface{}); ok && ag.path != "" {
+		fields["path"] = ag.path
+		if name, ok := fields["agent_name"].(string); ok {
+			fields["path"] = ag.stepPath(name)
+		}
+	}
+	if fields, ok := data.(map[string]interface{}); ok && ag.Variant != "" {
+		fields["variant"] = ag.Variant
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return
 	}
 
-	fmt.Fprintf(w, "event: %s\n", eventType)
-	fmt.Fprintf(w, "data: %s\n\n", jsonData)
+	// One write per event keeps events whole when map items stream concurrently
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, jsonData)
 
 	// Flush the response writer to ensure immediate delivery
 	if flusher, ok := w.(http.Flusher); ok {
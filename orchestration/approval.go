@@ -0,0 +1,134 @@
+package orchestration
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+)
+
+// APPROVAL_TIMEOUT is how long a parked execution waits for a reviewer.
+const APPROVAL_TIMEOUT = time.Hour
+
+var (
+	ErrNotAwaitingApproval = errors.New("execution is not awaiting approval")
+	ErrInvalidEdit         = errors.New("edited output does not match the agent's output schema")
+)
+
+// ApprovalDecision is a reviewer's verdict on a parked agent output.
+// Text, when set on an approval, replaces the output passed downstream.
+type ApprovalDecision struct {
+	Approve bool
+	Text    string
+	Comment string
+
+	// parsed holds the edited text decoded against the agent's output schema
+	parsed any
+}
+
+// RequireApproval parks the pipeline after the named agent until Resolve is called.
+func (ag *AgentManager) RequireApproval(agentName string) {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+
+	if ag.approvalSteps == nil {
+		ag.approvalSteps = make(map[string]bool)
+	}
+	ag.approvalSteps[agentName] = true
+}
+
+// Resolve delivers a reviewer's decision to the parked execution. Edits of
+// structured output must still match the parked agent's schema.
+func (ag *AgentManager) Resolve(decision ApprovalDecision) error {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+
+	if ag.decisions == nil {
+		return ErrNotAwaitingApproval
+	}
+	if decision.Approve && decision.Text != "" && ag.parked.OutputSchema != nil {
+		parsed, err := agents.ValidateOutput(ag.parked.OutputSchema, decision.Text)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidEdit, err)
+		}
+		decision.parsed = parsed
+	}
+
+	ag.decisions <- decision
+	ag.decisions, ag.parked = nil, nil
+	return nil
+}
+
+// AwaitingApproval reports whether the execution is parked at an approval step.
+func (ag *AgentManager) AwaitingApproval() bool {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	return ag.decisions != nil
+}
+
+// awaitApproval parks after an agent with an approval step and applies the decision.
+func (ag *AgentManager) awaitApproval(w http.ResponseWriter, agent *agents.Agent, output *agents.Output) (*agents.Output, error) {
+	ag.mutex.Lock()
+	if !ag.approvalSteps[agent.Name] {
+		ag.mutex.Unlock()
+		return output, nil
+	}
+	decisions := make(chan ApprovalDecision, 1)
+	ag.decisions, ag.parked = decisions, agent
+	ag.mutex.Unlock()
+
+	ag.sendAgentUpdate(w, "awaiting_approval", map[string]interface{}{
+		"execution_id": ag.executionID,
+		"agent_name":   agent.Name,
+		"agent_output": output.Text,
+		"message":      fmt.Sprintf("⏸️ Waiting for approval of '%s' output", agent.Name),
+	})
+
+	var decision ApprovalDecision
+	select {
+	case decision = <-decisions:
+	case <-time.After(APPROVAL_TIMEOUT):
+		ag.stopWaiting()
+		return nil, fmt.Errorf("approval of agent '%s' timed out", agent.Name)
+	case <-ag.context().Done():
+		ag.stopWaiting()
+		return nil, fmt.Errorf("approval of agent '%s' abandoned: %w", agent.Name, ag.context().Err())
+	}
+
+	if !decision.Approve {
+		ag.sendAgentUpdate(w, "approval_rejected", map[string]interface{}{
+			"agent_name": agent.Name,
+			"comment":    decision.Comment,
+			"message":    fmt.Sprintf("🚫 Output of '%s' rejected", agent.Name),
+		})
+		return nil, fmt.Errorf("output of agent '%s' rejected by reviewer: %s", agent.Name, decision.Comment)
+	}
+
+	edited := decision.Text != ""
+	if edited {
+		// The edit replaces what the agent said, not what it cost
+		part := agents.TextPart(decision.Text)
+		if decision.parsed != nil {
+			part = agents.JSONPart(decision.parsed)
+		}
+		output = &agents.Output{Text: decision.Text, Parsed: decision.parsed, Parts: []agents.Part{part}, Usage: output.Usage}
+	}
+
+	ag.sendAgentUpdate(w, "approval_granted", map[string]interface{}{
+		"agent_name":   agent.Name,
+		"edited":       edited,
+		"agent_output": output.Text,
+		"comment":      decision.Comment,
+		"message":      fmt.Sprintf("👍 Output of '%s' approved", agent.Name),
+	})
+	return output, nil
+}
+
+// stopWaiting unparks the execution so late decisions are refused.
+func (ag *AgentManager) stopWaiting() {
+	ag.mutex.Lock()
+	defer ag.mutex.Unlock()
+	ag.decisions, ag.parked = nil, nil
+}
@@ -0,0 +1,103 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+)
+
+// park runs awaitApproval for agent in the background and waits until it is parked.
+func park(t *testing.T, manager *AgentManager, agent *agents.Agent, output *agents.Output) <-chan error {
+	t.Helper()
+
+	manager.RequireApproval(agent.Name)
+	done := make(chan error, 1)
+	go func() {
+		resolved, err := manager.awaitApproval(httptest.NewRecorder(), agent, output)
+		if err == nil {
+			*output = *resolved
+		}
+		done <- err
+	}()
+
+	for !manager.AwaitingApproval() {
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+func TestApprovalEdits(t *testing.T) {
+	schema := map[string]any{"type": "object", "required": []any{"title"}}
+	usage := agents.Usage{PromptTokens: 10, CompletionTokens: 5}
+
+	tests := []struct {
+		name       string
+		schema     map[string]any
+		text       string
+		wantErr    error
+		wantParsed bool
+	}{
+		{name: "text edit", text: "edited"},
+		{name: "structured edit", schema: schema, text: `{"title": "edited"}`, wantParsed: true},
+		{name: "edit breaking the schema", schema: schema, text: `{"name": "edited"}`, wantErr: ErrInvalidEdit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &AgentManager{}
+			agent := &agents.Agent{Name: "writer", OutputSchema: tt.schema}
+			output := &agents.Output{Text: "draft", Usage: usage}
+			done := park(t, manager, agent, output)
+
+			err := manager.Resolve(ApprovalDecision{Approve: true, Text: tt.text})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if !manager.AwaitingApproval() {
+					t.Fatal("a refused edit unparked the execution")
+				}
+				manager.Resolve(ApprovalDecision{Approve: true})
+				<-done
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if output.Text != tt.text || output.Usage != usage {
+				t.Fatalf("got %q with usage %+v, want the edit with the original usage", output.Text, output.Usage)
+			}
+			if (output.Parsed != nil) != tt.wantParsed {
+				t.Fatalf("got parsed output %v, want parsed: %v", output.Parsed, tt.wantParsed)
+			}
+		})
+	}
+}
+
+func TestApprovalAbandonedWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := &AgentManager{Context: ctx}
+	done := park(t, manager, &agents.Agent{Name: "writer"}, &agents.Output{Text: "draft"})
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("execution stayed parked after its context ended")
+	}
+
+	if err := manager.Resolve(ApprovalDecision{Approve: true}); !errors.Is(err, ErrNotAwaitingApproval) {
+		t.Fatalf("got error %v, want ErrNotAwaitingApproval", err)
+	}
+}
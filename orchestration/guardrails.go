@@ -0,0 +1,293 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// What happens when a guardrail trips.
+const (
+	ACTION_FAIL   = "fail"
+	ACTION_REDACT = "redact"
+	ACTION_RETRY  = "retry"
+
+	// ACTION_WARN reports the trip and passes the output on unchanged
+	ACTION_WARN = "warn"
+)
+
+// MAX_GUARDRAIL_RETRIES bounds how often a step is re-run by retry guardrails.
+const MAX_GUARDRAIL_RETRIES = 2
+
+// Validator inspects a step's output and returns a Violation when it is not allowed,
+// along with the tokens spent deciding; only model-backed validators spend any.
+type Validator interface {
+	Validate(ctx context.Context, output string) (*Violation, agents.Usage, error)
+}
+
+// Violation explains why an output was rejected. Redacted is the output with the
+// offending content removed, or empty when the validator cannot redact.
+type Violation struct {
+	Reason   string
+	Redacted string
+}
+
+// Guardrail runs a validator on a step's output before it is handed on.
+type Guardrail struct {
+	Name      string
+	Validator Validator
+	Action    string
+}
+
+// AddGuardrail validates the output of the named step after every run.
+func (ag *AgentManager) AddGuardrail(stepName string, guardrail Guardrail) {
+	if ag.guardrails == nil {
+		ag.guardrails = make(map[string][]Guardrail)
+	}
+	ag.guardrails[stepName] = append(ag.guardrails[stepName], guardrail)
+}
+
+// handleGuarded runs a step and its guardrails in the step's span, re-running the step when a retry guardrail trips.
+// Retries skip cached responses, which would trip the guardrail again, and their output carries the usage of every attempt.
+func (ag *AgentManager) handleGuarded(w http.ResponseWriter, step *agents.Agent, input []agents.Part) (output *agents.Output, err error) {
+	ctx, span := tracing.Tracer().Start(ag.context(), "agent "+step.Name, trace.WithAttributes(
+		attribute.String("promptmesh.agent", step.Name),
+		attribute.String("promptmesh.role", step.Role),
+		attribute.String("promptmesh.path", ag.stepPath(step.Name)),
+		attribute.String("gen_ai.system", step.Provider),
+		attribute.String("gen_ai.request.model", step.Model),
+	))
+	defer func() {
+		if output != nil {
+			span.SetAttributes(
+				attribute.Int("gen_ai.usage.input_tokens", output.Usage.PromptTokens),
+				attribute.Int("gen_ai.usage.output_tokens", output.Usage.CompletionTokens),
+				attribute.Bool("promptmesh.cached", output.Cached),
+			)
+		}
+		tracing.End(span, err)
+	}()
+
+	var rejected agents.Usage
+	for attempt := 0; ; attempt++ {
+		span.SetAttributes(attribute.Int("promptmesh.guardrail_retries", attempt))
+
+		if attempt > 0 {
+			ctx = agents.WithCacheRefresh(ctx)
+		}
+		output, err = ag.handle(ctx, w, step, input)
+		if err != nil {
+			ag.addUsage(rejected)
+			return nil, err
+		}
+
+		var violation *Violation
+		output, violation, err = ag.applyGuardrails(ctx, w, step, output, attempt)
+		if err == nil && violation == nil {
+			output.Usage.Add(rejected)
+			return output, nil
+		}
+
+		rejected.Add(output.Usage)
+		if err != nil {
+			ag.addUsage(rejected)
+			return nil, err
+		}
+		if attempt == MAX_GUARDRAIL_RETRIES {
+			ag.addUsage(rejected)
+			return nil, fmt.Errorf("guardrail still tripped after %d retries: %s", MAX_GUARDRAIL_RETRIES, violation.Reason)
+		}
+	}
+}
+
+// applyGuardrails checks output against the step's guardrails. It returns a copy of the
+// (possibly redacted) output whose usage includes the validators', even when it fails,
+// along with the violation of a retry guardrail.
+func (ag *AgentManager) applyGuardrails(ctx context.Context, w http.ResponseWriter, step *agents.Agent, output *agents.Output, attempt int) (*agents.Output, *Violation, error) {
+	checked := *output
+	output = &checked
+	for _, guardrail := range ag.guardrails[step.Name] {
+		violation, usage, err := guardrail.Validator.Validate(ctx, output.Text)
+		output.Usage.Add(usage)
+		if err != nil {
+			return output, nil, fmt.Errorf("guardrail '%s' failed: %w", guardrail.Name, err)
+		}
+		if violation == nil {
+			continue
+		}
+
+		action := guardrail.Action
+		if action == ACTION_REDACT && violation.Redacted == "" {
+			action = ACTION_FAIL
+		}
+
+		if w != nil {
+			icon := "🛡️"
+			if action == ACTION_WARN {
+				icon = "⚠️"
+			}
+			ag.sendAgentUpdate(w, "guardrail_triggered", map[string]interface{}{
+				"agent_name": step.Name,
+				"guardrail":  guardrail.Name,
+				"action":     action,
+				"reason":     violation.Reason,
+				"attempt":    attempt + 1,
+				"message":    fmt.Sprintf("%s Guardrail '%s' tripped on '%s': %s", icon, guardrail.Name, step.Name, violation.Reason),
+			})
+		}
+
+		switch action {
+		case ACTION_WARN:
+		case ACTION_REDACT:
+			output = redactedOutput(output, violation.Redacted)
+		case ACTION_RETRY:
+			return output, violation, nil
+		default:
+			return output, nil, fmt.Errorf("guardrail '%s' blocked the output: %s", guardrail.Name, violation.Reason)
+		}
+	}
+	return output, nil, nil
+}
+
+// redactedOutput replaces the text of an output; images are kept, while the
+// parsed JSON is dropped since it may hold what was redacted.
+func redactedOutput(output *agents.Output, text string) *agents.Output {
+	parts := []agents.Part{agents.TextPart(text)}
+	for _, part := range output.Parts {
+		if part.Type == agents.PART_IMAGE {
+			parts = append(parts, part)
+		}
+	}
+	return &agents.Output{Text: text, Parts: parts, Cached: output.Cached, Usage: output.Usage}
+}
+
+// DenyList rejects outputs matching any of its patterns.
+type DenyList struct {
+	Patterns []*regexp.Regexp
+}
+
+func (d DenyList) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	redacted := output
+	var matches int
+	for _, pattern := range d.Patterns {
+		matches += len(pattern.FindAllStringIndex(redacted, -1))
+		redacted = pattern.ReplaceAllString(redacted, "[REDACTED]")
+	}
+	if matches == 0 {
+		return nil, agents.Usage{}, nil
+	}
+	return &Violation{Reason: fmt.Sprintf("matched %d denied pattern(s)", matches), Redacted: redacted}, agents.Usage{}, nil
+}
+
+// PIIDetector rejects outputs containing emails, phone numbers or card numbers.
+type PIIDetector struct{}
+
+func (PIIDetector) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	var kinds []string
+	redacted := agents.ReplacePII(output, func(kind, _ string) string {
+		kinds = append(kinds, kind)
+		return "[REDACTED " + strings.ToUpper(kind) + "]"
+	})
+	if len(kinds) == 0 {
+		return nil, agents.Usage{}, nil
+	}
+	return &Violation{Reason: "found personal data: " + strings.Join(kinds, ", "), Redacted: redacted}, agents.Usage{}, nil
+}
+
+// MaxLength rejects outputs longer than Limit characters; redacting truncates them.
+type MaxLength struct {
+	Limit int
+}
+
+func (m MaxLength) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	length := utf8.RuneCountInString(output)
+	if length <= m.Limit {
+		return nil, agents.Usage{}, nil
+	}
+	return &Violation{
+		Reason:   fmt.Sprintf("output has %d characters, limit is %d", length, m.Limit),
+		Redacted: string([]rune(output)[:m.Limit]),
+	}, agents.Usage{}, nil
+}
+
+// JSONValidator rejects outputs that are not JSON, or that do not match Schema when set.
+type JSONValidator struct {
+	Schema map[string]any
+}
+
+func (j JSONValidator) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	if _, err := agents.ValidateOutput(j.Schema, output); err != nil {
+		return &Violation{Reason: err.Error()}, agents.Usage{}, nil
+	}
+	return nil, agents.Usage{}, nil
+}
+
+// injectionPatterns are phrasings typical of text trying to take over the next agent.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,40}\b(previous|prior|above|earlier|all|your)\b.{0,20}\b(instructions?|prompts?|rules|directions)\b`),
+	regexp.MustCompile(`(?i)\b(you are now|from now on,? you|pretend to be)\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|real) (system )?(instructions?|prompt)\s*:`),
+	regexp.MustCompile(`(?i)\b(reveal|print|repeat|show)\b.{0,30}\b(system prompt|system message|instructions)\b`),
+	regexp.MustCompile(`(?i)<\s*/?\s*(system|data|instructions?)\s*>`),
+}
+
+// InjectionDetector flags outputs that look like they carry instructions for the next agent.
+type InjectionDetector struct{}
+
+func (InjectionDetector) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	for _, pattern := range injectionPatterns {
+		if match := pattern.FindString(output); match != "" {
+			return &Violation{Reason: fmt.Sprintf("suspected prompt injection: %q", match)}, agents.Usage{}, nil
+		}
+	}
+	return nil, agents.Usage{}, nil
+}
+
+// judgeVerdictSchema is the structured answer asked of a judge agent.
+var judgeVerdictSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"allowed": map[string]any{"type": "boolean"},
+		"reason":  map[string]any{"type": "string"},
+	},
+	"required": []any{"allowed", "reason"},
+}
+
+// JudgeValidator asks an agent, whose system message states the policy, whether
+// an output is allowed. NewAgent builds a fresh judge per check, which runs in the
+// step's context and bills its tokens to the step.
+type JudgeValidator struct {
+	NewAgent func() (*agents.Agent, error)
+}
+
+func (j JudgeValidator) Validate(ctx context.Context, output string) (*Violation, agents.Usage, error) {
+	judge, err := j.NewAgent()
+	if err != nil {
+		return nil, agents.Usage{}, err
+	}
+	judge.OutputSchema = judgeVerdictSchema
+
+	verdict, err := judge.HandleContext(ctx, []agents.Part{agents.TextPart("Decide whether this output is allowed.\n\nOutput:\n" + output)})
+	if err != nil {
+		return nil, agents.Usage{}, err
+	}
+
+	fields, ok := verdict.Parsed.(map[string]any)
+	if !ok {
+		return nil, verdict.Usage, errors.New("judge did not return a structured verdict")
+	}
+	if fields["allowed"] == true {
+		return nil, verdict.Usage, nil
+	}
+	reason, _ := fields["reason"].(string)
+	return &Violation{Reason: "judge rejected the output: " + reason}, verdict.Usage, nil
+}
@@ -0,0 +1,173 @@
+package orchestration
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// sequenceModel answers with its replies in turn, repeating the last one,
+// and reports 3 prompt and 2 completion tokens per call.
+type sequenceModel struct {
+	replies []string
+	calls   int
+}
+
+func (m *sequenceModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	reply := m.replies[min(m.calls, len(m.replies)-1)]
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:        reply,
+		GenerationInfo: map[string]any{"PromptTokens": 3, "CompletionTokens": 2},
+	}}}, nil
+}
+
+func (m *sequenceModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// rejectWord trips on outputs containing its word.
+type rejectWord string
+
+func (r rejectWord) Validate(_ context.Context, output string) (*Violation, agents.Usage, error) {
+	if strings.Contains(output, string(r)) {
+		return &Violation{Reason: "mentions " + string(r)}, agents.Usage{}, nil
+	}
+	return nil, agents.Usage{}, nil
+}
+
+func TestRetryGuardrail(t *testing.T) {
+	tests := []struct {
+		name       string
+		replies    []string
+		want       string
+		wantErr    string
+		wantCalls  int
+		wantTokens int
+	}{
+		{name: "passes first time", replies: []string{"good"}, want: "good", wantCalls: 1, wantTokens: 3},
+		{name: "passes on retry", replies: []string{"bad", "good"}, want: "good", wantCalls: 2, wantTokens: 6},
+		{name: "never passes", replies: []string{"bad"}, wantErr: "guardrail still tripped after 2 retries: mentions bad", wantCalls: 3, wantTokens: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &sequenceModel{replies: tt.replies}
+			cache := agents.NewMemoryCache(time.Hour)
+
+			run := func() (*agents.Output, *AgentManager, error) {
+				agent, err := agents.NewReplayAgent("writer", "writer", "Write.", "openai", "gpt-4o-mini", agents.NewCassette())
+				if err != nil {
+					t.Fatal(err)
+				}
+				agent.LLM, agent.Cache, agent.CacheMode, agent.Verbose = model, cache, agents.CACHE_READ, false
+
+				manager := &AgentManager{FirstPrompt: "Write something"}
+				manager.AddToPipeline(agent)
+				manager.AddGuardrail("writer", Guardrail{Name: "no-bad", Validator: rejectWord("bad"), Action: ACTION_RETRY})
+				output, err := manager.StartPipeline()
+				return output, manager, err
+			}
+
+			output, manager, err := run()
+			if model.calls != tt.wantCalls {
+				t.Fatalf("model called %d times, want %d", model.calls, tt.wantCalls)
+			}
+			if manager.Usage().PromptTokens != tt.wantTokens {
+				t.Fatalf("pipeline used %d prompt tokens, want %d", manager.Usage().PromptTokens, tt.wantTokens)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.Text != tt.want || output.Usage.PromptTokens != tt.wantTokens {
+				t.Fatalf("got %q with %d prompt tokens, want %q with %d", output.Text, output.Usage.PromptTokens, tt.want, tt.wantTokens)
+			}
+
+			// The accepted response replaced the rejected one in the cache
+			output, _, err = run()
+			if err != nil || !output.Cached || output.Text != tt.want {
+				t.Fatalf("rerun got %+v and error %v, want the cached %q", output, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryGuardrailOnSubPipeline(t *testing.T) {
+	model := &sequenceModel{replies: []string{"bad", "good"}}
+	agent, err := agents.NewReplayAgent("writer", "writer", "Write.", "openai", "gpt-4o-mini", agents.NewCassette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.LLM, agent.Verbose = model, false
+
+	sub := &AgentManager{}
+	sub.AddToPipeline(agent)
+	manager := &AgentManager{FirstPrompt: "Write something"}
+	manager.AddSubPipeline("report", sub)
+	manager.AddGuardrail("report", Guardrail{Name: "no-bad", Validator: rejectWord("bad"), Action: ACTION_RETRY})
+
+	output, err := manager.StartPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each of the two runs spent 3 prompt tokens; the rejected one counts once
+	if output.Text != "good" || manager.Usage().PromptTokens != 6 {
+		t.Fatalf("got %q with %d prompt tokens, want good with 6", output.Text, manager.Usage().PromptTokens)
+	}
+}
+
+func TestJudgeGuardrailBillsTheStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		verdict string
+		wantErr string
+	}{
+		{name: "allowed", verdict: `{"allowed": true, "reason": "fine"}`},
+		{name: "rejected", verdict: `{"allowed": false, "reason": "rude"}`, wantErr: "judge rejected the output: rude"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newAgent := func(name string, model llms.Model) *agents.Agent {
+				agent, err := agents.NewReplayAgent(name, name, "Decide.", "openai", "gpt-4o-mini", agents.NewCassette())
+				if err != nil {
+					t.Fatal(err)
+				}
+				agent.LLM, agent.Verbose = model, false
+				return agent
+			}
+
+			manager := &AgentManager{FirstPrompt: "Write something"}
+			manager.AddToPipeline(newAgent("writer", &sequenceModel{replies: []string{"text"}}))
+			manager.AddGuardrail("writer", Guardrail{Name: "policy", Action: ACTION_FAIL, Validator: JudgeValidator{
+				NewAgent: func() (*agents.Agent, error) {
+					return newAgent("judge", &sequenceModel{replies: []string{tt.verdict}}), nil
+				},
+			}})
+
+			output, err := manager.StartPipeline()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || output.Usage.PromptTokens != 6 {
+				t.Fatalf("got %+v and error %v, want the writer's and judge's 6 prompt tokens", output, err)
+			}
+
+			if manager.Usage().PromptTokens != 6 {
+				t.Fatalf("pipeline used %d prompt tokens, want 6", manager.Usage().PromptTokens)
+			}
+		})
+	}
+}
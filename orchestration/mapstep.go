@@ -0,0 +1,229 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+)
+
+const (
+	SPLIT_LINES = "lines"
+	SPLIT_JSON  = "json"
+	SPLIT_REGEX = "regex"
+
+	JOIN_TEXT = "text"
+	JOIN_JSON = "json"
+
+	// MAP_STEP_ROLE is the role reported for map steps.
+	MAP_STEP_ROLE = "map"
+
+	DEFAULT_MAP_CONCURRENCY = 4
+)
+
+// MapStep splits the previous step's output into items, runs a pipeline on
+// each item concurrently and joins the results into the step's output.
+type MapStep struct {
+	// Split is SPLIT_LINES, SPLIT_JSON or SPLIT_REGEX, which splits on Separator.
+	Split       string
+	Separator   *regexp.Regexp
+	Concurrency int
+
+	// NewItemPipeline builds the pipeline run on one item. Agents keep
+	// conversation memory, so every item gets its own.
+	NewItemPipeline func() (*AgentManager, error)
+
+	// Join is JOIN_TEXT or JOIN_JSON; Reducer, when set, receives the joined results.
+	Join    string
+	Reducer *AgentManager
+}
+
+// AddMapStep appends a map step to the pipeline.
+func (ag *AgentManager) AddMapStep(name string, step *MapStep) {
+	placeholder := &agents.Agent{Name: name, Role: MAP_STEP_ROLE}
+
+	if ag.mapSteps == nil {
+		ag.mapSteps = make(map[*agents.Agent]*MapStep)
+	}
+	ag.mapSteps[placeholder] = step
+	ag.AddToPipeline(placeholder)
+}
+
+// runMap runs a map step; w is nil when not streaming.
+func (ag *AgentManager) runMap(ctx context.Context, w http.ResponseWriter, name string, step *MapStep, input []agents.Part) (*agents.Output, error) {
+	items, err := splitItems(input, step.Split, step.Separator)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("map step found no items in its input")
+	}
+
+	// Items stream their events concurrently, so writes to the stream are serialized
+	if w != nil {
+		w = &syncWriter{ResponseWriter: w}
+	}
+	ag.sendMapUpdate(w, "map_started", map[string]interface{}{
+		"agent_name": name,
+		"total":      len(items),
+		"message":    fmt.Sprintf("🗂️ Map step '%s' processing %d item(s)", name, len(items)),
+	})
+
+	concurrency := step.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_MAP_CONCURRENCY
+	}
+	limit := make(chan struct{}, concurrency)
+
+	results := make([]*agents.Output, len(items))
+	errs := make([]error, len(items))
+	var completed atomic.Int32
+	var wg sync.WaitGroup
+
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			results[i], errs[i] = ag.runMapItem(ctx, w, name, step, i, item)
+			if errs[i] == nil {
+				ag.sendMapUpdate(w, "map_item_completed", map[string]interface{}{
+					"agent_name":   name,
+					"index":        i,
+					"completed":    completed.Add(1),
+					"total":        len(items),
+					"agent_output": results[i].Text,
+					"message":      fmt.Sprintf("✅ Item %d of map step '%s' completed", i, name),
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var texts []string
+	var usage agents.Usage
+	for _, result := range results {
+		texts = append(texts, result.Text)
+		usage.Add(result.Usage)
+	}
+
+	joined := joinResults(texts, step.Join)
+	output := &agents.Output{Text: joined, Parts: []agents.Part{agents.TextPart(joined)}}
+	if step.Reducer != nil {
+		output, err = ag.runNested(ctx, w, step.Reducer, ag.stepPath(name)+"/reduce", output.Parts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	output.Usage.Add(usage)
+	return output, nil
+}
+
+// runMapItem runs a fresh item pipeline on one item; its events carry the path name/index/agent.
+func (ag *AgentManager) runMapItem(ctx context.Context, w http.ResponseWriter, name string, step *MapStep, index int, item string) (*agents.Output, error) {
+	sub, err := step.NewItemPipeline()
+	if err != nil {
+		return nil, fmt.Errorf("item %d: %w", index, err)
+	}
+
+	output, err := ag.runNested(ctx, w, sub, fmt.Sprintf("%s/%d", ag.stepPath(name), index), []agents.Part{agents.TextPart(item)})
+	if err != nil {
+		ag.sendMapUpdate(w, "map_item_failed", map[string]interface{}{
+			"agent_name": name,
+			"index":      index,
+			"message":    fmt.Sprintf("❌ Item %d of map step '%s' failed: %v", index, name, err),
+		})
+		return nil, fmt.Errorf("item %d: %w", index, err)
+	}
+	return output, nil
+}
+
+func (ag *AgentManager) sendMapUpdate(w http.ResponseWriter, eventType string, data map[string]interface{}) {
+	if w != nil {
+		ag.sendAgentUpdate(w, eventType, data)
+	}
+}
+
+// splitItems splits the step input into the items to process, dropping blank ones.
+// JSON splitting prefers the parsed output of a structured agent over the text.
+func splitItems(input []agents.Part, mode string, separator *regexp.Regexp) ([]string, error) {
+	text := agents.JoinText(input)
+
+	var pieces []string
+	switch mode {
+	case SPLIT_JSON:
+		var values []any
+		for _, part := range input {
+			if list, ok := part.JSON.([]any); ok && part.Type == agents.PART_JSON {
+				values = list
+			}
+		}
+		if values == nil {
+			if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &values); err != nil {
+				return nil, fmt.Errorf("map step input is not a JSON array: %w", err)
+			}
+		}
+		for _, value := range values {
+			if s, ok := value.(string); ok {
+				pieces = append(pieces, s)
+				continue
+			}
+			raw, _ := json.Marshal(value)
+			pieces = append(pieces, string(raw))
+		}
+	case SPLIT_REGEX:
+		pieces = separator.Split(text, -1)
+	default:
+		pieces = strings.Split(text, "\n")
+	}
+
+	var items []string
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) != "" {
+			items = append(items, piece)
+		}
+	}
+	return items, nil
+}
+
+func joinResults(results []string, join string) string {
+	if join == JOIN_JSON {
+		raw, _ := json.Marshal(results)
+		return string(raw)
+	}
+	return strings.Join(results, "\n\n")
+}
+
+// syncWriter serializes writes from concurrent map items to one SSE stream.
+type syncWriter struct {
+	http.ResponseWriter
+	mutex sync.Mutex
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *syncWriter) Flush() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,102 @@
+package orchestration
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// fixedModel gives the same reply to every call and counts them.
+type fixedModel struct {
+	reply string
+	calls int
+}
+
+func (m *fixedModel) GenerateContent(_ context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: m.reply}}}, nil
+}
+
+func (m *fixedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// newPipeline builds a writer and reviewer pipeline answering from cassette,
+// recording through models when they are given.
+func newPipeline(t *testing.T, cassette *agents.Cassette, prompt string, models ...llms.Model) *AgentManager {
+	t.Helper()
+
+	manager := &AgentManager{FirstPrompt: prompt}
+	for i, name := range []string{"writer", "reviewer"} {
+		agent, err := agents.NewReplayAgent(name, name, "You are the "+name+".", "openai", "gpt-4o-mini", cassette)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(models) > 0 {
+			agent.LLM = cassette.Record(models[i])
+		}
+		agent.Verbose = false
+		manager.AddToPipeline(agent)
+	}
+	return manager
+}
+
+func TestPipelineReplaysRecordedTraffic(t *testing.T) {
+	writer, reviewer := &fixedModel{reply: "A draft about otters."}, &fixedModel{reply: "Approved: otters."}
+
+	recorded, err := newPipeline(t, agents.NewCassette(), "Write about otters", writer, reviewer).StartPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		prompt  string
+		want    string
+		wantErr bool
+	}{
+		{name: "same prompt", prompt: "Write about otters", want: recorded.Text},
+		{name: "changed prompt", prompt: "Write about beavers", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cassette := agents.NewCassette()
+			newPipeline(t, cassette, "Write about otters", writer, reviewer).StartPipeline()
+
+			path := filepath.Join(t.TempDir(), "pipeline.json")
+			if err := cassette.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := agents.LoadCassette(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			calls := writer.calls + reviewer.calls
+			output, err := newPipeline(t, loaded, tt.prompt).StartPipeline()
+			if writer.calls+reviewer.calls != calls {
+				t.Fatal("replay reached the provider")
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("replayed %q without a recording", output.Text)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.Text != tt.want {
+				t.Fatalf("got %q, want %q", output.Text, tt.want)
+			}
+		})
+	}
+
+	if recorded.Text != reviewer.reply {
+		t.Fatalf("pipeline returned %q, want the last agent's reply", recorded.Text)
+	}
+}
@@ -0,0 +1,66 @@
+package orchestration
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+)
+
+// SUB_PIPELINE_ROLE is the role reported for steps that run a nested pipeline.
+const SUB_PIPELINE_ROLE = "sub-pipeline"
+
+// AddSubPipeline appends a step that runs a nested pipeline on the previous
+// step's output; the nested pipeline's final output becomes the step's output.
+func (ag *AgentManager) AddSubPipeline(name string, sub *AgentManager) {
+	step := &agents.Agent{Name: name, Role: SUB_PIPELINE_ROLE}
+
+	if ag.subPipelines == nil {
+		ag.subPipelines = make(map[*agents.Agent]*AgentManager)
+	}
+	ag.subPipelines[step] = sub
+	ag.AddToPipeline(step)
+}
+
+// handle runs one step of the pipeline under the step's span; w is nil when not streaming.
+func (ag *AgentManager) handle(ctx context.Context, w http.ResponseWriter, step *agents.Agent, input []agents.Part) (*agents.Output, error) {
+	if sub, ok := ag.subPipelines[step]; ok {
+		return ag.runNested(ctx, w, sub, ag.stepPath(step.Name), input)
+	}
+	if mapStep, ok := ag.mapSteps[step]; ok {
+		return ag.runMap(ctx, w, step.Name, mapStep, input)
+	}
+	return step.HandleContext(ctx, input)
+}
+
+// runNested runs a nested pipeline, forwarding its events under path when streaming.
+// The output's usage covers this run of the nested pipeline; a retried step runs it again.
+func (ag *AgentManager) runNested(ctx context.Context, w http.ResponseWriter, sub *AgentManager, path string, input []agents.Part) (*agents.Output, error) {
+	sub.Context = ctx
+	sub.resetUsage()
+
+	var output *agents.Output
+	var err error
+	if w != nil {
+		sub.path = path
+		sub.Variant = ag.Variant
+		output, err = sub.runStream(w, input)
+	} else {
+		sub.connectAgents()
+		output, err = sub.executePipeline(sub.pipeline[0], input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	output.Usage = sub.Usage()
+	return output, nil
+}
+
+// stepPath is the hierarchical name of a step, e.g. report/summarize.
+func (ag *AgentManager) stepPath(name string) string {
+	if ag.path == "" {
+		return name
+	}
+	return ag.path + "/" + name
+}
@@ -0,0 +1,46 @@
+package orchestration
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+)
+
+// VariantResult is how one pipeline variant did on the shared input.
+type VariantResult struct {
+	Variant string
+	Output  *agents.Output
+	Err     error
+	Latency time.Duration
+	Usage   agents.Usage
+}
+
+// RunVariants streams several pipelines concurrently on one stream, each
+// manager's events tagged with its Variant, and returns their results in order.
+func RunVariants(w http.ResponseWriter, managers []*AgentManager) []VariantResult {
+	stream := &syncWriter{ResponseWriter: w}
+	results := make([]VariantResult, len(managers))
+
+	var wg sync.WaitGroup
+	for i, manager := range managers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			output, err := manager.runStream(stream, manager.firstInput())
+			results[i] = VariantResult{
+				Variant: manager.Variant,
+				Output:  output,
+				Err:     err,
+				Latency: time.Since(start),
+				Usage:   manager.Usage(),
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
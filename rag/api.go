@@ -0,0 +1,219 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+const (
+	CHUNK_SIZE    = 1000
+	CHUNK_OVERLAP = 100
+)
+
+// Chunk is an embedded slice of an uploaded document.
+type Chunk struct {
+	Source string    `json:"source"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// Collection groups the chunks of related documents.
+type Collection struct {
+	Name   string  `json:"name"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Store keeps collections in memory and mirrors each one to a JSON file in dir.
+type Store struct {
+	dir         string
+	embedder    embeddings.Embedder
+	collections map[string]*Collection
+	mutex       sync.RWMutex
+}
+
+// NewStore loads every collection previously saved in dir.
+func NewStore(dir string, embedder embeddings.Embedder) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:         dir,
+		embedder:    embedder,
+		collections: make(map[string]*Collection),
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var collection Collection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, fmt.Errorf("invalid collection %s: %w", path, err)
+		}
+		s.collections[collection.Name] = &collection
+	}
+
+	return s, nil
+}
+
+// AddDocument chunks and embeds a document, returning how many chunks were stored.
+func (s *Store) AddDocument(ctx context.Context, collection, source, text string) (int, error) {
+	if strings.TrimSpace(text) == "" {
+		return 0, fmt.Errorf("document '%s' is empty", source)
+	}
+
+	splitter := textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(CHUNK_SIZE),
+		textsplitter.WithChunkOverlap(CHUNK_OVERLAP),
+	)
+	texts, err := splitter.SplitText(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to chunk '%s': %w", source, err)
+	}
+
+	vectors, err := s.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed '%s': %w", source, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.collections[collection]
+	if !ok {
+		c = &Collection{Name: collection}
+		s.collections[collection] = c
+	}
+	for i, chunkText := range texts {
+		c.Chunks = append(c.Chunks, Chunk{Source: source, Text: chunkText, Vector: vectors[i]})
+	}
+
+	return len(texts), s.save(c)
+}
+
+func (s *Store) save(c *Collection) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, c.Name+".json"), data, 0o644)
+}
+
+// Counts reports the number of chunks in each collection.
+func (s *Store) Counts() map[string]int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	counts := make(map[string]int, len(s.collections))
+	for name, c := range s.collections {
+		counts[name] = len(c.Chunks)
+	}
+	return counts
+}
+
+func (s *Store) Has(collection string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.collections[collection]
+	return ok
+}
+
+// Search returns the k chunks most similar to the query.
+func (s *Store) Search(ctx context.Context, collection, query string, k int) ([]Chunk, error) {
+	vector, err := s.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	s.mutex.RLock()
+	c, ok := s.collections[collection]
+	if !ok {
+		s.mutex.RUnlock()
+		return nil, fmt.Errorf("collection '%s' not found", collection)
+	}
+	chunks := append([]Chunk(nil), c.Chunks...)
+	s.mutex.RUnlock()
+
+	scores := make([]float64, len(chunks))
+	order := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		scores[i] = Cosine(vector, chunk.Vector)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	top := make([]Chunk, 0, min(k, len(chunks)))
+	for _, i := range order[:cap(top)] {
+		top = append(top, chunks[i])
+	}
+	return top, nil
+}
+
+// Retriever adapts a collection to the agents.Retriever interface.
+func (s *Store) Retriever(collection string, k int) *Retriever {
+	return &Retriever{store: s, collection: collection, k: k}
+}
+
+type Retriever struct {
+	store      *Store
+	collection string
+	k          int
+}
+
+func (r *Retriever) Retrieve(ctx context.Context, query string) ([]string, error) {
+	chunks, err := r.store.Search(ctx, r.collection, query, r.k)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = fmt.Sprintf("[%s]\n%s", chunk.Source, chunk.Text)
+	}
+	return texts, nil
+}
+
+// Cosine is the cosine similarity of two vectors, or -1 when their sizes differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return -1
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// ValidateName keeps collection names usable as file names.
+func ValidateName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return errors.New("collection name must be a plain file name")
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// MASTER_KEY_SIZE is the length of the AES-256 master key in bytes.
+	MASTER_KEY_SIZE = 32
+
+	CREDENTIALS_FILE = "credentials.json"
+	USES_FILE        = "uses.jsonl"
+)
+
+var (
+	ErrNotFound = errors.New("credential not found")
+	ErrExists   = errors.New("credential already exists")
+)
+
+// Credential is a named provider API key owned by a workspace, or by none when
+// the caller does not partition them. Only its encrypted form is kept.
+type Credential struct {
+	Workspace  string    `json:"workspace,omitempty"`
+	Name       string    `json:"name"`
+	Provider   string    `json:"provider"`
+	Ciphertext string    `json:"ciphertext"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	RotatedAt  time.Time `json:"rotated_at"`
+}
+
+// Use records that an execution read a credential.
+type Use struct {
+	Workspace   string    `json:"workspace,omitempty"`
+	Credential  string    `json:"credential"`
+	Version     int       `json:"version"`
+	ExecutionID string    `json:"execution_id"`
+	Time        time.Time `json:"time"`
+}
+
+// Store keeps credentials encrypted with AES-GCM under a master key, mirrored
+// to a JSON file in dir, and appends every use to a JSONL audit file.
+type Store struct {
+	dir         string
+	aead        cipher.AEAD
+	credentials map[string]*Credential // by workspace/name
+	uses        []Use
+	recorded    map[string]bool // credential versions and executions already in uses
+	mutex       sync.RWMutex
+}
+
+// NewStore opens the store in dir, failing when the master key cannot decrypt it.
+func NewStore(dir string, masterKey []byte) (*Store, error) {
+	if len(masterKey) != MASTER_KEY_SIZE {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", MASTER_KEY_SIZE, len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:         dir,
+		aead:        aead,
+		credentials: make(map[string]*Credential),
+		recorded:    make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, CREDENTIALS_FILE))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var credentials []*Credential
+		if err := json.Unmarshal(data, &credentials); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", CREDENTIALS_FILE, err)
+		}
+		for _, credential := range credentials {
+			if _, err := s.decrypt(credential); err != nil {
+				return nil, fmt.Errorf("cannot decrypt credential '%s', wrong master key?", credential.Name)
+			}
+			s.credentials[credentialKey(credential.Workspace, credential.Name)] = credential
+		}
+	}
+
+	if err := s.loadUses(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create stores a new credential in a workspace.
+func (s *Store) Create(workspace, name, provider, key string) (*Credential, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := credentialKey(workspace, name)
+	if _, ok := s.credentials[id]; ok {
+		return nil, ErrExists
+	}
+
+	now := time.Now()
+	credential := &Credential{Workspace: workspace, Name: name, Provider: provider, Version: 1, CreatedAt: now, RotatedAt: now}
+	if err := s.encrypt(credential, key); err != nil {
+		return nil, err
+	}
+
+	s.credentials[id] = credential
+	if err := s.save(); err != nil {
+		delete(s.credentials, id)
+		return nil, err
+	}
+	return credential, nil
+}
+
+// Rotate replaces the key of a credential and bumps its version.
+func (s *Store) Rotate(workspace, name, key string) (*Credential, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := credentialKey(workspace, name)
+	current, ok := s.credentials[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	rotated := *current
+	rotated.Version++
+	rotated.RotatedAt = time.Now()
+	if err := s.encrypt(&rotated, key); err != nil {
+		return nil, err
+	}
+
+	s.credentials[id] = &rotated
+	if err := s.save(); err != nil {
+		s.credentials[id] = current
+		return nil, err
+	}
+	return &rotated, nil
+}
+
+func (s *Store) Delete(workspace, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := credentialKey(workspace, name)
+	current, ok := s.credentials[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(s.credentials, id)
+	if err := s.save(); err != nil {
+		s.credentials[id] = current
+		return err
+	}
+	return nil
+}
+
+// List returns the credentials of a workspace sorted by name.
+func (s *Store) List(workspace string) []Credential {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	credentials := make([]Credential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		if credential.Workspace == workspace {
+			credentials = append(credentials, *credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool { return credentials[i].Name < credentials[j].Name })
+	return credentials
+}
+
+// Reveal decrypts a credential of provider for an execution and records the use once per execution.
+func (s *Store) Reveal(workspace, name, provider, executionID string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	credential, ok := s.credentials[credentialKey(workspace, name)]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if credential.Provider != provider {
+		return "", fmt.Errorf("credential is for provider '%s', not '%s'", credential.Provider, provider)
+	}
+
+	key, err := s.decrypt(credential)
+	if err != nil {
+		return "", err
+	}
+
+	seen := useKey(workspace, name, credential.Version, executionID)
+	if !s.recorded[seen] {
+		use := Use{Workspace: workspace, Credential: name, Version: credential.Version, ExecutionID: executionID, Time: time.Now()}
+		if err := s.appendUse(use); err != nil {
+			return "", fmt.Errorf("failed to audit credential use: %w", err)
+		}
+		s.recorded[seen] = true
+	}
+
+	return key, nil
+}
+
+// Uses returns the recorded uses of a workspace's credential, oldest first.
+func (s *Store) Uses(workspace, name string) []Use {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	uses := []Use{}
+	for _, use := range s.uses {
+		if use.Workspace == workspace && use.Credential == name {
+			uses = append(uses, use)
+		}
+	}
+	return uses
+}
+
+// encrypt seals key into credential, bound to its workspace, name, provider and version.
+func (s *Store) encrypt(credential *Credential, key string) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(key), additionalData(credential))
+	credential.Ciphertext = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+func (s *Store) decrypt(credential *Credential) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(credential.Ciphertext)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	key, err := s.aead.Open(nil, nonce, ciphertext, additionalData(credential))
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+func additionalData(credential *Credential) []byte {
+	// Credentials without a workspace keep the binding they were stored with
+	if credential.Workspace == "" {
+		return []byte(fmt.Sprintf("%s/%s/%d", credential.Name, credential.Provider, credential.Version))
+	}
+	return []byte(fmt.Sprintf("%s/%s/%s/%d", credential.Workspace, credential.Name, credential.Provider, credential.Version))
+}
+
+func credentialKey(workspace, name string) string {
+	return workspace + "/" + name
+}
+
+func useKey(workspace, name string, version int, executionID string) string {
+	return fmt.Sprintf("%s/%s/%d/%s", workspace, name, version, executionID)
+}
+
+// save writes the credentials file; callers hold the write lock.
+func (s *Store) save() error {
+	credentials := make([]*Credential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		credentials = append(credentials, credential)
+	}
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, CREDENTIALS_FILE), data, 0o600)
+}
+
+func (s *Store) loadUses() error {
+	file, err := os.Open(filepath.Join(s.dir, USES_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var use Use
+		if err := json.Unmarshal(scanner.Bytes(), &use); err != nil {
+			return fmt.Errorf("invalid %s: %w", USES_FILE, err)
+		}
+		s.uses = append(s.uses, use)
+		s.recorded[useKey(use.Workspace, use.Credential, use.Version, use.ExecutionID)] = true
+	}
+	return scanner.Err()
+}
+
+// appendUse adds a use to the audit file; callers hold the write lock.
+func (s *Store) appendUse(use Use) error {
+	file, err := os.OpenFile(filepath.Join(s.dir, USES_FILE), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := json.Marshal(use)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.uses = append(s.uses, use)
+	return nil
+}
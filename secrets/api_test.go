@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir, masterKey := t.TempDir(), bytes.Repeat([]byte{7}, MASTER_KEY_SIZE)
+
+	store, err := NewStore(dir, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("", "legacy", "openai", "sk-legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("team-a", "main", "openai", "sk-first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("team-a", "main", "openai", "sk-again"); !errors.Is(err, ErrExists) {
+		t.Fatalf("got error %v, want ErrExists", err)
+	}
+	if _, err := store.Rotate("team-a", "main", "sk-second"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening decrypts what the first store wrote
+	reopened, err := NewStore(dir, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		workspace string
+		key       string
+		provider  string
+		want      string
+		wantErr   error
+	}{
+		{name: "without workspace", key: "legacy", provider: "openai", want: "sk-legacy"},
+		{name: "rotated", workspace: "team-a", key: "main", provider: "openai", want: "sk-second"},
+		{name: "other workspace", workspace: "team-b", key: "main", provider: "openai", wantErr: ErrNotFound},
+		{name: "other provider", workspace: "team-a", key: "main", provider: "anthropic"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reopened.Reveal(tt.workspace, tt.key, tt.provider, "pipeline-1")
+			if tt.want == "" {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("got %q and error %v, want an error", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	uses := reopened.Uses("team-a", "main")
+	if len(uses) != 1 || uses[0].Version != 2 || uses[0].ExecutionID != "pipeline-1" {
+		t.Fatalf("got uses %+v, want one use of version 2", uses)
+	}
+}
+
+func TestStoreRejectsWrongMasterKey(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, bytes.Repeat([]byte{1}, MASTER_KEY_SIZE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("", "main", "openai", "sk-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewStore(dir, bytes.Repeat([]byte{2}, MASTER_KEY_SIZE)); err == nil {
+		t.Fatal("opened the store with the wrong master key")
+	}
+	if _, err := NewStore(dir, []byte("short")); err == nil {
+		t.Fatal("accepted a short master key")
+	}
+}
@@ -1,20 +1,39 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"regexp"
 	"time"
 
 	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
 	"github.com/AlexsanderHamir/PromptMesh/orchestration"
 	"github.com/AlexsanderHamir/PromptMesh/shared"
+	"github.com/AlexsanderHamir/PromptMesh/tools"
+	"github.com/AlexsanderHamir/PromptMesh/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func NewServer() *Server {
 	s := &Server{
 		executions: make(map[string]*PipelineExecution),
+		batches:    make(map[string]*Batch),
+		cache:      newCache(),
+		rag:        newRAGStore(),
+		keys:       newKeyStore(),
+		secrets:    newSecretsStore(),
+		limits:     newProviderLimits(),
+		clients:    newClientLimits(),
+		workspaces: newWorkspaceStore(),
+		audit:      newAuditLog(),
 	}
 
 	// Start cleanup goroutine
@@ -23,6 +42,9 @@ func NewServer() *Server {
 		defer ticker.Stop()
 		for range ticker.C {
 			s.cleanupOldExecutions()
+			if cache, ok := s.cache.(*agents.MemoryCache); ok {
+				cache.Sweep()
+			}
 		}
 	}()
 
@@ -30,6 +52,13 @@ func NewServer() *Server {
 }
 
 func InitServer() *http.ServeMux {
+	if err := setupLogging(os.Getenv(ENV_LOG_LEVEL), os.Getenv(ENV_LOG_FORMAT)); err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
+	if err := tracing.Setup(os.Getenv(ENV_TRACE_EXPORTER), os.Getenv(ENV_OTLP_ENDPOINT), os.Getenv(ENV_TRACE_FILE)); err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
 	s := NewServer()
 	mux := http.NewServeMux()
 
@@ -39,7 +68,7 @@ func InitServer() *http.ServeMux {
 			// Set CORS headers
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, "+PROVIDER_KEY_HEADER)
 
 			// Handle preflight requests
 			if r.Method == http.MethodOptions {
@@ -58,8 +87,27 @@ func InitServer() *http.ServeMux {
 // RegisterRoutes sets up the server's HTTP routes with CORS middleware
 func (s *Server) registerRoutes(mux *http.ServeMux, corsHandler func(http.HandlerFunc) http.HandlerFunc) {
 	mux.HandleFunc("/", corsHandler(s.HealthCheck))
-	mux.HandleFunc("/api/pipelines/execute", corsHandler(s.ExecutePipeline))
-	mux.HandleFunc("/api/pipelines/execute/stream", corsHandler(s.ExecutePipelineStream))
+	mux.HandleFunc("/metrics", corsHandler(s.requireScope(SCOPE_READ, s.Metrics)))
+	mux.HandleFunc("/api/pipelines/execute", corsHandler(s.requireScope(SCOPE_RUN, s.limitRate(s.ExecutePipeline))))
+	mux.HandleFunc("/api/pipelines/execute/stream", corsHandler(s.requireScope(SCOPE_RUN, s.limitRate(s.ExecutePipelineStream))))
+	mux.HandleFunc("/api/executions/{id}", corsHandler(s.requireScope(SCOPE_READ, s.GetExecution)))
+	mux.HandleFunc("/api/executions/{id}/approve", corsHandler(s.requireScope(SCOPE_RUN, s.ApproveExecution)))
+	mux.HandleFunc("/api/pipelines/batch", corsHandler(s.requireScope(SCOPE_RUN, s.limitRate(s.ExecuteBatch))))
+	mux.HandleFunc("/api/batches/{id}/results", corsHandler(s.requireScope(SCOPE_READ, s.DownloadBatch)))
+	mux.HandleFunc("/api/evaluations", corsHandler(s.requireScope(SCOPE_RUN, s.limitRate(s.RunEvaluation))))
+	mux.HandleFunc("/api/pipelines/compare/stream", corsHandler(s.requireScope(SCOPE_RUN, s.limitRate(s.ComparePipelines))))
+	mux.HandleFunc("/api/collections", corsHandler(s.requireScope(SCOPE_READ, s.ListCollections)))
+	mux.HandleFunc("/api/collections/{name}/documents", corsHandler(s.requireScope(SCOPE_RUN, s.UploadDocuments)))
+	mux.HandleFunc("/api/keys", corsHandler(s.requireScope(SCOPE_ADMIN, s.ManageKeys)))
+	mux.HandleFunc("/api/keys/{id}", corsHandler(s.requireScope(SCOPE_ADMIN, s.RevokeKey)))
+	mux.HandleFunc("/api/credentials", corsHandler(s.requireScope(SCOPE_ADMIN, s.ManageCredentials)))
+	mux.HandleFunc("/api/credentials/{name}", corsHandler(s.requireScope(SCOPE_ADMIN, s.DeleteCredential)))
+	mux.HandleFunc("/api/credentials/{name}/rotate", corsHandler(s.requireScope(SCOPE_ADMIN, s.RotateCredential)))
+	mux.HandleFunc("/api/credentials/{name}/uses", corsHandler(s.requireScope(SCOPE_ADMIN, s.CredentialUses)))
+	mux.HandleFunc("/api/workspaces", corsHandler(s.requireScope(SCOPE_ADMIN, s.ManageWorkspaces)))
+	mux.HandleFunc("/api/workspaces/{name}/usage", corsHandler(s.requireScope(SCOPE_READ, s.WorkspaceUsage)))
+	mux.HandleFunc("/api/audit", corsHandler(s.requireScope(SCOPE_ADMIN, s.QueryAudit)))
+	mux.HandleFunc("/api/audit/verify", corsHandler(s.requireScope(SCOPE_ADMIN, s.VerifyAudit)))
 }
 
 // validateAgentOrder ensures agents have unique names and validates the order
@@ -80,137 +128,487 @@ func validateAgentOrder(agents []AgentConfig) error {
 	return nil
 }
 
-// ExecutePipeline handles the complete pipeline execution in one request
-func (s *Server) ExecutePipeline(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
+// validateCacheMode rejects unknown per-request cache modes
+func validateCacheMode(mode string) error {
+	switch mode {
+	case "", agents.CACHE_BYPASS, agents.CACHE_READ, agents.CACHE_WRITE:
+		return nil
 	}
+	return fmt.Errorf("invalid cache mode '%s', expected one of: %s, %s, %s", mode, agents.CACHE_BYPASS, agents.CACHE_READ, agents.CACHE_WRITE)
+}
 
-	var req ExecutePipelineRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendError(w, http.StatusBadRequest, "Invalid JSON")
-		return
+// newAgent builds an agent for one request, honoring its cache and cassette settings
+func (s *Server) newAgent(cfg AgentConfig, envVar string, req ExecutePipelineRequest, cassette *agents.Cassette) (*agents.Agent, error) {
+	var agent *agents.Agent
+	var err error
+
+	replay := cassette != nil && req.CassetteMode == agents.CASSETTE_REPLAY
+	apiKey := req.providerKeys[cfg.Provider]
+	if cfg.Credential != "" && !replay {
+		if apiKey, err = s.revealCredential(cfg, req); err != nil {
+			return nil, err
+		}
 	}
 
-	// Validate required fields
-	if req.Name == "" || req.FirstPrompt == "" {
-		s.sendError(w, http.StatusBadRequest, "Missing required fields: name, first_prompt")
-		return
+	switch {
+	case replay:
+		agent, err = agents.NewReplayAgent(cfg.Name, cfg.Role, cfg.SystemMsg, cfg.Provider, cfg.Model, cassette)
+	case apiKey != "":
+		agent, err = agents.NewAgentWithKey(cfg.Name, cfg.Role, cfg.SystemMsg, cfg.Provider, apiKey, cfg.Model)
+	default:
+		agent, err = agents.NewAgent(cfg.Name, cfg.Role, cfg.SystemMsg, cfg.Provider, envVar, cfg.Model)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if len(req.Agents) == 0 {
-		s.sendError(w, http.StatusBadRequest, "At least one agent is required")
-		return
+	if cassette != nil && req.CassetteMode == agents.CASSETTE_RECORD {
+		agent.LLM = cassette.Record(agent.LLM)
+	}
+
+	// Redact outside the cassette so recordings never hold the original values
+	if req.redactor != nil {
+		agent.LLM = req.redactor.Wrap(agent.LLM)
+	}
+
+	agent.Cache = workspaceCache(s.cache, req.workspace)
+	agent.CacheMode = req.Cache
+	agent.Pipeline = req.Name
+	agent.ExecutionID = req.executionID
+	if !replay {
+		agent.Limits = s.limits
+	}
+
+	if len(cfg.Tools) > 0 && len(cfg.OutputSchema) > 0 {
+		return nil, errors.New("output_schema cannot be combined with tools")
+	}
+
+	for _, toolConfig := range cfg.Tools {
+		tool, err := s.newTool(toolConfig, req, cassette)
+		if err != nil {
+			return nil, err
+		}
+		agent.Tools = append(agent.Tools, tool)
+	}
+
+	if cfg.Collection != "" {
+		if err := validateCollectionName(cfg.Collection); err != nil {
+			return nil, err
+		}
+		collection := collectionName(req.workspace, cfg.Collection)
+		if s.rag == nil || !s.rag.Has(collection) {
+			return nil, fmt.Errorf("collection '%s' not found", cfg.Collection)
+		}
+		topK := cfg.TopK
+		if topK <= 0 {
+			topK = DEFAULT_TOP_K
+		}
+		agent.Retriever = s.rag.Retriever(collection, topK)
 	}
 
-	// Validate agent order and uniqueness
+	if len(cfg.OutputSchema) > 0 {
+		if err := json.Unmarshal(cfg.OutputSchema, &agent.OutputSchema); err != nil {
+			return nil, fmt.Errorf("invalid output_schema: %w", err)
+		}
+		agent.OutputRetries = DEFAULT_OUTPUT_RETRIES
+		if cfg.OutputRetries != nil {
+			agent.OutputRetries = *cfg.OutputRetries
+		}
+	}
+
+	return agent, nil
+}
+
+// newTool builds a tool from its config, enforcing the server-side allowlists;
+// pipeline tools run with the settings of req and record to or replay from its cassette
+func (s *Server) newTool(cfg ToolConfig, req ExecutePipelineRequest, cassette *agents.Cassette) (agents.Tool, error) {
+	switch cfg.Type {
+	case tools.TOOL_HTTP_GET:
+		hosts := envList(ENV_HTTP_ALLOWLIST)
+		if len(hosts) == 0 {
+			return nil, fmt.Errorf("tool %s is disabled: set %s", cfg.Type, ENV_HTTP_ALLOWLIST)
+		}
+		return &tools.HTTPGet{AllowedHosts: hosts}, nil
+	case tools.TOOL_SHELL:
+		commands := envList(ENV_SHELL_ALLOWLIST)
+		if len(commands) == 0 {
+			return nil, fmt.Errorf("tool %s is disabled: set %s", cfg.Type, ENV_SHELL_ALLOWLIST)
+		}
+		return &tools.Shell{AllowedCommands: commands}, nil
+	case tools.TOOL_CALCULATOR:
+		return &tools.Calculator{}, nil
+	case tools.TOOL_PIPELINE:
+		if cfg.Name == "" || cfg.Pipeline == nil {
+			return nil, errors.New("pipeline tools require name and pipeline")
+		}
+		// Tool arguments arrive restored, so the nested agents redact them again with the same placeholders
+		nested := cfg.Pipeline.inheriting(req, true)
+		return &tools.Pipeline{
+			Name:        cfg.Name,
+			Description: cfg.Description,
+			Run: func(ctx context.Context, input string) (string, error) {
+				return s.runNestedPipeline(ctx, nested, cassette, input)
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown tool type '%s'", cfg.Type)
+}
+
+// runNestedPipeline executes a pipeline definition synchronously with the given first prompt,
+// tracing it under ctx
+func (s *Server) runNestedPipeline(ctx context.Context, req ExecutePipelineRequest, cassette *agents.Cassette, input string) (string, error) {
+	manager, err := s.newNestedManager(req, cassette)
+	if err != nil {
+		return "", err
+	}
+	manager.FirstPrompt = input
+	manager.Context = ctx
+
+	output, err := manager.StartPipeline()
+	if err != nil {
+		return "", err
+	}
+	return output.Text, nil
+}
+
+// newNestedManager builds the agents of a pipeline definition used by a tool, a sub-pipeline step,
+// or a batch, comparison or evaluation run
+func (s *Server) newNestedManager(req ExecutePipelineRequest, cassette *agents.Cassette) (*orchestration.AgentManager, error) {
 	if err := validateAgentOrder(req.Agents); err != nil {
-		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Agent validation failed: %v", err))
-		return
+		return nil, err
 	}
+	req = req.withRedactor()
 
-	// Create execution session
-	executionID := generateID(PIPELINE_PREFIX)
-	manager := &orchestration.AgentManager{
-		FirstPrompt: req.FirstPrompt,
+	manager := &orchestration.AgentManager{}
+	for i, agentConfig := range req.Agents {
+		if agentConfig.RequiresApproval {
+			return nil, errors.New("approval steps are not supported in nested pipelines")
+		}
+
+		if err := s.addGuardrails(manager, agentConfig, req, cassette); err != nil {
+			return nil, err
+		}
+
+		if agentConfig.isComposite() {
+			if err := s.addCompositeStep(manager, agentConfig, req, cassette, i > 0 || req.nested); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		envVar, ok := shared.ProviderEnvVars[agentConfig.Provider]
+		if !ok {
+			return nil, fmt.Errorf("provider '%s' is not supported", agentConfig.Provider)
+		}
+
+		agent, err := s.newAgent(agentConfig, envVar, req, cassette)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create agent '%s': %w", agentConfig.Name, err)
+		}
+		agent.Verbose = false
+		agent.IsolateInput = req.IsolateInputs && (i > 0 || req.nested)
+		manager.AddToPipeline(agent)
 	}
 
+	return manager, nil
+}
+
+// newSubPipeline builds the nested pipeline of a step; it inherits the parent's cache and cassette settings
+func (s *Server) newSubPipeline(cfg AgentConfig, parent ExecutePipelineRequest, cassette *agents.Cassette, fed bool) (*orchestration.AgentManager, error) {
+	nested := cfg.Pipeline.inheriting(parent, fed)
+	nested.IsolateInputs = nested.IsolateInputs || parent.IsolateInputs
+
+	manager, err := s.newNestedManager(nested, cassette)
+	if err != nil {
+		return nil, fmt.Errorf("sub-pipeline '%s': %w", cfg.Name, err)
+	}
+	return manager, nil
+}
+
+// addCompositeStep adds a sub-pipeline or map step to manager; fed is false for a
+// step that receives the caller's own prompt
+func (s *Server) addCompositeStep(manager *orchestration.AgentManager, cfg AgentConfig, req ExecutePipelineRequest, cassette *agents.Cassette, fed bool) error {
+	if cfg.Pipeline != nil {
+		sub, err := s.newSubPipeline(cfg, req, cassette, fed)
+		if err != nil {
+			return err
+		}
+		manager.AddSubPipeline(cfg.Name, sub)
+		return nil
+	}
+
+	step, err := s.newMapStep(cfg, req, cassette, fed)
+	if err != nil {
+		return fmt.Errorf("map step '%s': %w", cfg.Name, err)
+	}
+	manager.AddMapStep(cfg.Name, step)
+	return nil
+}
+
+// newMapStep builds a map step whose items and reducer run as sub-pipelines of the step;
+// items are split from the step's input, so they are fed like the step itself
+func (s *Server) newMapStep(cfg AgentConfig, parent ExecutePipelineRequest, cassette *agents.Cassette, fed bool) (*orchestration.MapStep, error) {
+	m := cfg.Map
+	if m.Concurrency > MAX_MAP_CONCURRENCY {
+		return nil, fmt.Errorf("concurrency must be at most %d", MAX_MAP_CONCURRENCY)
+	}
+	if m.Join != "" && m.Join != orchestration.JOIN_TEXT && m.Join != orchestration.JOIN_JSON {
+		return nil, fmt.Errorf("invalid join '%s', expected %s or %s", m.Join, orchestration.JOIN_TEXT, orchestration.JOIN_JSON)
+	}
+
+	step := &orchestration.MapStep{Split: m.Split, Concurrency: m.Concurrency, Join: m.Join}
+	switch m.Split {
+	case "", orchestration.SPLIT_LINES, orchestration.SPLIT_JSON:
+	case orchestration.SPLIT_REGEX:
+		separator, err := regexp.Compile(m.Separator)
+		if err != nil || m.Separator == "" {
+			return nil, fmt.Errorf("invalid separator '%s'", m.Separator)
+		}
+		step.Separator = separator
+	default:
+		return nil, fmt.Errorf("invalid split '%s', expected %s, %s or %s", m.Split, orchestration.SPLIT_LINES, orchestration.SPLIT_JSON, orchestration.SPLIT_REGEX)
+	}
+
+	item := AgentConfig{Name: cfg.Name, Pipeline: m.Pipeline}
+	if m.Agent != nil {
+		item.Pipeline = &ExecutePipelineRequest{Name: cfg.Name, Agents: []AgentConfig{*m.Agent}}
+	}
+	if item.Pipeline == nil {
+		return nil, errors.New("agent or pipeline is required")
+	}
+
+	// Build the item pipeline once up front so configuration errors surface before the run
+	if _, err := s.newSubPipeline(item, parent, cassette, fed); err != nil {
+		return nil, err
+	}
+	step.NewItemPipeline = func() (*orchestration.AgentManager, error) {
+		return s.newSubPipeline(item, parent, cassette, fed)
+	}
+
+	if m.Reducer != nil {
+		reducer := AgentConfig{Name: cfg.Name, Pipeline: &ExecutePipelineRequest{Name: cfg.Name, Agents: []AgentConfig{*m.Reducer}}}
+		manager, err := s.newSubPipeline(reducer, parent, cassette, true)
+		if err != nil {
+			return nil, err
+		}
+		step.Reducer = manager
+	}
+
+	return step, nil
+}
+
+// validateImages ensures images go to a first agent that can see them
+func validateImages(agentConfigs []AgentConfig, images []agents.Part) error {
+	if len(images) > 0 && !shared.VisionProviders[agentConfigs[0].Provider] {
+		return fmt.Errorf("images require the first agent to use a vision provider, got '%s'", agentConfigs[0].Provider)
+	}
+	return nil
+}
+
+// errAgentSetup marks failures to build an agent, as opposed to invalid requests
+var errAgentSetup = errors.New("failed to create agent")
+
+// buildManager validates an execute request and builds its execution, agents included,
+// with the request completed by its execution ID, redactor and attachment text.
+// Approval steps are only accepted when approvals is set.
+func (s *Server) buildManager(req ExecutePipelineRequest, attachments []Attachment, approvals bool) (ExecutePipelineRequest, *PipelineExecution, error) {
+	images := firstAgentImages(req, attachments)
+	if err := validateExecution(req, images, approvals); err != nil {
+		return req, nil, err
+	}
+	req = req.withRedactor()
+	req.FirstPrompt = withAttachmentText(req.FirstPrompt, attachments)
+	req.executionID = generateID(PIPELINE_PREFIX)
+
+	cassette, err := openCassette(req)
+	if err != nil {
+		return req, nil, fmt.Errorf("cassette unavailable: %v", err)
+	}
+
+	// Images reach the first agent as content parts; document text is already in the prompt
+	manager := &orchestration.AgentManager{FirstPrompt: req.FirstPrompt, Attachments: images}
 	execution := &PipelineExecution{
-		ID:          executionID,
+		ID:          req.executionID,
+		Workspace:   req.workspace,
 		Name:        req.Name,
 		Manager:     manager,
 		FirstPrompt: req.FirstPrompt,
 		Agents:      []*agents.Agent{},
+		Attachments: attachments,
 		CreatedAt:   time.Now(),
+		Cassette:    cassette,
+	}
+	if err := s.addSteps(execution, req); err != nil {
+		return req, nil, err
 	}
+	return req, execution, nil
+}
 
-	// Create and add agents to the pipeline
+// validateExecution checks the settings of an execute request before anything is built
+func validateExecution(req ExecutePipelineRequest, images []agents.Part, approvals bool) error {
+	if err := validateAgentOrder(req.Agents); err != nil {
+		return fmt.Errorf("agent validation failed: %v", err)
+	}
+	if err := validateCacheMode(req.Cache); err != nil {
+		return err
+	}
+	for _, agentConfig := range req.Agents {
+		if agentConfig.RequiresApproval && !approvals {
+			return errors.New("approval steps require the streaming endpoint")
+		}
+	}
+	return validateImages(req.Agents, images)
+}
+
+// addSteps adds the request's agents and composite steps to the execution's pipeline
+func (s *Server) addSteps(execution *PipelineExecution, req ExecutePipelineRequest) error {
+	manager := execution.Manager
 	for i, agentConfig := range req.Agents {
-		if agentConfig.Name == "" || agentConfig.Role == "" || agentConfig.SystemMsg == "" || agentConfig.Provider == "" {
-			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Agent %d missing required fields: name, role, system_msg, provider", i+1))
-			return
+		if err := s.addGuardrails(manager, agentConfig, req, execution.Cassette); err != nil {
+			return err
 		}
 
-		envVar, ok := shared.ProviderEnvVars[agentConfig.Provider]
-		if !ok {
-			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Provider '%s' is not supported. Supported providers: %s", agentConfig.Provider, getSupportedProviders()))
-			return
+		if agentConfig.isComposite() {
+			if err := s.addCompositeStep(manager, agentConfig, req, execution.Cassette, i > 0); err != nil {
+				return err
+			}
+		} else {
+			agent, err := s.newTopLevelAgent(i, agentConfig, req, execution.Cassette)
+			if err != nil {
+				return err
+			}
+			execution.Agents = append(execution.Agents, agent)
+			manager.AddToPipeline(agent)
 		}
 
-		agent, err := agents.NewAgent(
-			agentConfig.Name,
-			agentConfig.Role,
-			agentConfig.SystemMsg,
-			agentConfig.Provider,
-			envVar,
-			agentConfig.Model,
-		)
-		if err != nil {
-			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create agent '%s': %v", agentConfig.Name, err))
-			return
+		if agentConfig.RequiresApproval {
+			manager.RequireApproval(agentConfig.Name)
 		}
+	}
+	return nil
+}
 
-		execution.Agents = append(execution.Agents, agent)
-		manager.AddToPipeline(agent)
+// newTopLevelAgent builds the agent at position i of an execute request
+func (s *Server) newTopLevelAgent(i int, cfg AgentConfig, req ExecutePipelineRequest, cassette *agents.Cassette) (*agents.Agent, error) {
+	if cfg.Name == "" || cfg.Role == "" || cfg.SystemMsg == "" || cfg.Provider == "" {
+		return nil, fmt.Errorf("agent %d missing required fields: name, role, system_msg, provider", i+1)
 	}
 
-	// Store execution session
+	envVar, ok := shared.ProviderEnvVars[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("provider '%s' is not supported, supported providers: %s", cfg.Provider, getSupportedProviders())
+	}
+
+	agent, err := s.newAgent(cfg, envVar, req, cassette)
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %v", errAgentSetup, cfg.Name, err)
+	}
+
+	// The first agent takes the user's own prompt, every later one an upstream output
+	agent.IsolateInput = req.IsolateInputs && i > 0
+	return agent, nil
+}
+
+// storeExecution makes the execution visible to the execution and approval endpoints and audits it
+func (s *Server) storeExecution(r *http.Request, req ExecutePipelineRequest, execution *PipelineExecution) {
 	s.mutex.Lock()
-	s.executions[executionID] = execution
+	s.executions[execution.ID] = execution
 	s.mutex.Unlock()
+	s.recordAudit(r, audit.Entry{Action: AUDIT_PIPELINE_RUN, Pipeline: req.Name, ExecutionID: execution.ID, Agents: auditAgents(req.Agents)})
+}
 
-	// Execute the pipeline
-	result, err := manager.StartPipeline()
+// completeExecution records the outcome of a finished execution, its cassette, usage and metrics
+func (s *Server) completeExecution(req ExecutePipelineRequest, execution *PipelineExecution, output *agents.Output, err error) {
+	saveCassette(req, execution.Cassette)
+	s.workspaces.record(req.workspace, execution.Manager.Usage())
+	recordExecution(req.Name, execution.CreatedAt, err)
 
 	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	now := time.Now()
 	execution.CompletedAt = &now
 
+	// Release the agents so caller-supplied keys in their clients don't outlive the run
+	execution.Manager, execution.Agents = nil, nil
 	if err != nil {
 		errorMsg := err.Error()
 		execution.Error = &errorMsg
-		s.mutex.Unlock()
-		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Pipeline execution failed: %v", err))
 		return
 	}
+	execution.Result = &output.Text
+}
 
-	execution.Result = &result
-	s.mutex.Unlock()
-
-	s.sendJSON(w, http.StatusOK, ExecutePipelineResponse{
-		Result:  result,
-		Message: fmt.Sprintf("Pipeline '%s' executed successfully", req.Name),
-	})
+// decodeExecution reads an execute request and checks its required fields
+func decodeExecution(r *http.Request) (ExecutePipelineRequest, []Attachment, error) {
+	req, attachments, err := decodeExecuteRequest(r)
+	if err != nil {
+		return req, nil, err
+	}
+	if req.Name == "" || req.FirstPrompt == "" {
+		return req, nil, errors.New("missing required fields: name, first_prompt")
+	}
+	if len(req.Agents) == 0 {
+		return req, nil, errors.New("at least one agent is required")
+	}
+	return req, attachments, nil
 }
 
-// ExecutePipelineStream handles pipeline execution with streaming updates via Server-Sent Events
-func (s *Server) ExecutePipelineStream(w http.ResponseWriter, r *http.Request) {
+// ExecutePipeline handles the complete pipeline execution in one request
+func (s *Server) ExecutePipeline(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	var req ExecutePipelineRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+	req, attachments, err := decodeExecution(r)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Validate required fields
-	if req.Name == "" || req.FirstPrompt == "" {
-		s.sendError(w, http.StatusBadRequest, "Missing required fields: name, first_prompt")
+	req, execution, err := s.buildManager(req, attachments, false)
+	if errors.Is(err, errAgentSetup) {
+		s.sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	s.storeExecution(r, req, execution)
 
-	if len(req.Agents) == 0 {
-		s.sendError(w, http.StatusBadRequest, "At least one agent is required")
+	// Execute the pipeline
+	ctx, span := tracing.StartRequest(r, "ExecutePipeline", requestAttributes(req)...)
+	execution.Manager.Context = ctx
+	output, err := execution.Manager.StartPipeline()
+	tracing.End(span, err)
+	s.completeExecution(req, execution, output, err)
+
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Pipeline execution failed: %v", err))
 		return
 	}
 
-	// Validate agent order and uniqueness
-	if err := validateAgentOrder(req.Agents); err != nil {
-		s.sendSSEError(w, fmt.Sprintf("Agent validation failed: %v", err))
+	response := ExecutePipelineResponse{
+		Result:  output.Text,
+		Message: fmt.Sprintf("Pipeline '%s' executed successfully", req.Name),
+	}
+	if agents.HasMedia(output.Parts) {
+		response.Parts = output.Parts
+	}
+	s.sendJSON(w, http.StatusOK, response)
+}
+
+// ExecutePipelineStream handles pipeline execution with streaming updates via Server-Sent Events
+func (s *Server) ExecutePipelineStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	req, attachments, err := decodeExecution(r)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -222,74 +620,25 @@ func (s *Server) ExecutePipelineStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "Cache-Control")
 
-	// Create execution session
-	executionID := generateID(PIPELINE_PREFIX)
-	manager := &orchestration.AgentManager{
-		FirstPrompt: req.FirstPrompt,
-	}
-
-	execution := &PipelineExecution{
-		ID:          executionID,
-		Name:        req.Name,
-		Manager:     manager,
-		FirstPrompt: req.FirstPrompt,
-		Agents:      []*agents.Agent{},
-		CreatedAt:   time.Now(),
-	}
-
-	// Create and add agents to the pipeline
-	for i, agentConfig := range req.Agents {
-		if agentConfig.Name == "" || agentConfig.Role == "" || agentConfig.SystemMsg == "" || agentConfig.Provider == "" {
-			s.sendSSEError(w, fmt.Sprintf("Agent %d missing required fields: name, role, system_msg, provider", i+1))
-			return
-		}
-
-		envVar, ok := shared.ProviderEnvVars[agentConfig.Provider]
-		if !ok {
-			s.sendSSEError(w, fmt.Sprintf("Provider '%s' is not supported. Supported providers: %s", agentConfig.Provider, getSupportedProviders()))
-			return
-		}
-
-		agent, err := agents.NewAgent(
-			agentConfig.Name,
-			agentConfig.Role,
-			agentConfig.SystemMsg,
-			agentConfig.Provider,
-			envVar,
-			agentConfig.Model,
-		)
-		if err != nil {
-			s.sendSSEError(w, fmt.Sprintf("Failed to create agent '%s': %v", agentConfig.Name, err))
-			return
-		}
-
-		execution.Agents = append(execution.Agents, agent)
-		manager.AddToPipeline(agent)
+	req, execution, err := s.buildManager(req, attachments, true)
+	if err != nil {
+		s.sendSSEError(w, err.Error())
+		return
 	}
 
-	// Store execution session
-	s.mutex.Lock()
-	s.executions[executionID] = execution
-	s.mutex.Unlock()
-
-	// Send initial status
-	s.sendSSEMessage(w, "status", map[string]interface{}{
-		"type":         "pipeline_started",
-		"message":      fmt.Sprintf("🚀 Starting pipeline '%s' with %d agent(s)", req.Name, len(req.Agents)),
-		"execution_id": executionID,
-	})
+	s.storeExecution(r, req, execution)
+	ctx, span := tracing.StartRequest(r, "ExecutePipelineStream", requestAttributes(req)...)
+	execution.Manager.Context = ctx
+	s.sendStreamStarted(w, req, span)
 
 	// Execute the pipeline with streaming updates
-	result, err := manager.StartPipelineStream(w, executionID)
-
-	s.mutex.Lock()
-	now := time.Now()
-	execution.CompletedAt = &now
+	metrics.ActiveStreams.Inc(metrics.Pipelines.Value(req.Name))
+	output, err := execution.Manager.StartPipelineStream(w, execution.ID)
+	metrics.ActiveStreams.Dec(metrics.Pipelines.Value(req.Name))
+	tracing.End(span, err)
+	s.completeExecution(req, execution, output, err)
 
 	if err != nil {
-		errorMsg := err.Error()
-		execution.Error = &errorMsg
-		s.mutex.Unlock()
 		s.sendSSEMessage(w, "error", map[string]interface{}{
 			"type":    "pipeline_error",
 			"message": fmt.Sprintf("❌ Pipeline execution failed: %v", err),
@@ -297,20 +646,115 @@ func (s *Server) ExecutePipelineStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	execution.Result = &result
-	s.mutex.Unlock()
-
 	// Send final success message
-	s.sendSSEMessage(w, "status", map[string]interface{}{
+	completed := map[string]interface{}{
 		"type":    "pipeline_completed",
 		"message": fmt.Sprintf("🎉 Pipeline '%s' executed successfully!", req.Name),
-		"result":  result,
-	})
+		"result":  output.Text,
+	}
+	if agents.HasMedia(output.Parts) {
+		completed["result_parts"] = output.Parts
+	}
+	s.sendSSEMessage(w, "status", completed)
 
 	// Send end event
 	s.sendSSEMessage(w, "end", map[string]interface{}{
 		"type":         "pipeline_end",
-		"execution_id": executionID,
+		"execution_id": execution.ID,
+	})
+}
+
+// sendStreamStarted announces a streamed execution, with its trace ID when traced
+func (s *Server) sendStreamStarted(w http.ResponseWriter, req ExecutePipelineRequest, span trace.Span) {
+	started := map[string]interface{}{
+		"type":         "pipeline_started",
+		"message":      fmt.Sprintf("🚀 Starting pipeline '%s' with %d agent(s)", req.Name, len(req.Agents)),
+		"execution_id": req.executionID,
+	}
+	if span.SpanContext().IsValid() {
+		started["trace_id"] = span.SpanContext().TraceID().String()
+	}
+	s.sendSSEMessage(w, "status", started)
+}
+
+// GetExecution reports the status of an execution, including whether it awaits approval
+func (s *Server) GetExecution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	execution, ok := s.executions[r.PathValue("id")]
+	if !ok || execution.Workspace != workspaceOf(r) {
+		s.sendError(w, http.StatusNotFound, "Execution not found")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, ExecutionResponse{
+		ExecutionID: execution.ID,
+		Name:        execution.Name,
+		Status:      execution.status(),
+		CreatedAt:   execution.CreatedAt,
+		CompletedAt: execution.CompletedAt,
+		Result:      execution.Result,
+		Error:       execution.Error,
+	})
+}
+
+// ApproveExecution resumes an execution parked at an approval step
+func (s *Server) ApproveExecution(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if req.Decision != DECISION_APPROVE && req.Decision != DECISION_REJECT {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("decision must be '%s' or '%s'", DECISION_APPROVE, DECISION_REJECT))
+		return
+	}
+
+	s.mutex.RLock()
+	execution, ok := s.executions[r.PathValue("id")]
+	var manager *orchestration.AgentManager
+	if ok {
+		manager = execution.Manager
+	}
+	s.mutex.RUnlock()
+	if !ok || execution.Workspace != workspaceOf(r) {
+		s.sendError(w, http.StatusNotFound, "Execution not found")
+		return
+	}
+	if manager == nil {
+		s.sendError(w, http.StatusConflict, orchestration.ErrNotAwaitingApproval.Error())
+		return
+	}
+
+	err := manager.Resolve(orchestration.ApprovalDecision{
+		Approve: req.Decision == DECISION_APPROVE,
+		Text:    req.Text,
+		Comment: req.Comment,
+	})
+	if errors.Is(err, orchestration.ErrInvalidEdit) {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.sendError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_EXECUTION_APPROVE, Pipeline: execution.Name, ExecutionID: execution.ID, Detail: req.Decision})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"execution_id": execution.ID,
+		"decision":     req.Decision,
 	})
 }
 
@@ -341,6 +785,38 @@ func (s *Server) sendSSEError(w http.ResponseWriter, message string) {
 	})
 }
 
+// Metrics reports the server's metrics in the Prometheus text format
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
+
+// requestAttributes describe an execution on its root span
+func requestAttributes(req ExecutePipelineRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("promptmesh.pipeline", req.Name),
+		attribute.String("promptmesh.execution_id", req.executionID),
+		attribute.String("promptmesh.workspace", req.workspace),
+		attribute.Int("promptmesh.agents", len(req.Agents)),
+	}
+}
+
+// recordExecution counts a finished pipeline run and its duration
+func recordExecution(pipeline string, start time.Time, err error) {
+	status := STATUS_SUCCEEDED
+	if err != nil {
+		status = STATUS_FAILED
+	}
+	pipeline = metrics.Pipelines.Value(pipeline)
+	metrics.Executions.Inc(pipeline, status)
+	metrics.ExecutionDuration.Observe(time.Since(start).Seconds(), pipeline)
+}
+
 // HealthCheck provides a simple health check endpoint
 func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	s.sendJSON(w, http.StatusOK, map[string]interface{}{
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+	"github.com/AlexsanderHamir/PromptMesh/tools"
+)
+
+// fakeOpenAI answers chat completions like the OpenAI API and keeps every request body.
+// The parent agent's first call asks for the lookup tool, any agent without tools replies
+// "found" and the parent's call with the tool result replies "done".
+type fakeOpenAI struct {
+	bodies []string
+	mutex  sync.Mutex
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mutex.Lock()
+	f.bodies = append(f.bodies, string(body))
+	f.mutex.Unlock()
+
+	message := map[string]any{"role": "assistant", "content": "found"}
+	switch {
+	case strings.Contains(string(body), `"role":"tool"`):
+		message["content"] = "done"
+	case strings.Contains(string(body), `"tools"`):
+		arguments, _ := json.Marshal(map[string]string{"input": "Find the account of [EMAIL_1]"})
+		message["content"] = ""
+		message["tool_calls"] = []any{map[string]any{
+			"id": "call_1", "type": "function",
+			"function": map[string]any{"name": "lookup", "arguments": string(arguments)},
+		}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-4",
+		"choices": []any{map[string]any{"index": 0, "message": message, "finish_reason": "stop"}},
+		"usage":   map[string]any{"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2},
+	})
+}
+
+// toolPipelineRequest is a one-agent pipeline whose agent can call a nested "lookup" pipeline
+func toolPipelineRequest() ExecutePipelineRequest {
+	agent := func(name string) AgentConfig {
+		return AgentConfig{Name: name, Role: "assistant", SystemMsg: "Help.", Provider: shared.PROVIDER_OPENAI}
+	}
+	parent := agent("parent")
+	parent.Tools = []ToolConfig{{
+		Type:     tools.TOOL_PIPELINE,
+		Name:     "lookup",
+		Pipeline: &ExecutePipelineRequest{Name: "lookup", Agents: []AgentConfig{agent("search")}},
+	}}
+	req := ExecutePipelineRequest{Name: "support", Agents: []AgentConfig{parent}}
+	req.providerKeys = map[string]string{shared.PROVIDER_OPENAI: "sk-test"}
+	return req
+}
+
+func runToolPipeline(t *testing.T, req ExecutePipelineRequest, cassette *agents.Cassette) {
+	t.Helper()
+	s := &Server{}
+	manager, err := s.newNestedManager(req, cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.FirstPrompt = "Customer jane@example.com cannot log in"
+
+	output, err := manager.StartPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Text != "done" {
+		t.Fatalf("got %q, want done", output.Text)
+	}
+}
+
+func TestPipelineToolKeepsPIIRedacted(t *testing.T) {
+	provider := &fakeOpenAI{}
+	server := httptest.NewServer(provider)
+	defer server.Close()
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	req := toolPipelineRequest()
+	req.RedactPII = true
+	runToolPipeline(t, req, nil)
+
+	if len(provider.bodies) != 3 {
+		t.Fatalf("got %d provider calls, want 3", len(provider.bodies))
+	}
+	for i, body := range provider.bodies {
+		if strings.Contains(body, "jane@example.com") {
+			t.Errorf("call %d sent the address to the provider: %s", i+1, body)
+		}
+	}
+	if !strings.Contains(provider.bodies[1], "[EMAIL_1]") {
+		t.Errorf("nested call did not carry the placeholder: %s", provider.bodies[1])
+	}
+}
+
+func TestPipelineToolRecordsAndReplays(t *testing.T) {
+	provider := &fakeOpenAI{}
+	server := httptest.NewServer(provider)
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	cassette := agents.NewCassette()
+	req := toolPipelineRequest()
+	req.CassetteMode = agents.CASSETTE_RECORD
+	runToolPipeline(t, req, cassette)
+	server.Close()
+
+	if len(cassette.Interactions) != 3 {
+		t.Fatalf("recorded %d calls, want 3 including the nested pipeline's", len(cassette.Interactions))
+	}
+
+	// The provider is gone, so replay only succeeds if the nested pipeline answers from the cassette too
+	req.CassetteMode = agents.CASSETTE_REPLAY
+	runToolPipeline(t, req, cassette)
+}
+
+func TestBuildManager(t *testing.T) {
+	agent := func(name string) AgentConfig {
+		return AgentConfig{Name: name, Role: "assistant", SystemMsg: "Help.", Provider: shared.PROVIDER_OPENAI}
+	}
+	approval := agent("review")
+	approval.RequiresApproval = true
+
+	tests := []struct {
+		name      string
+		agents    []AgentConfig
+		cache     string
+		images    []string
+		approvals bool
+		wantErr   string
+	}{
+		{name: "valid", agents: []AgentConfig{agent("draft"), agent("edit")}},
+		{name: "approval when streaming", agents: []AgentConfig{agent("draft"), approval}, approvals: true},
+		{name: "approval without streaming", agents: []AgentConfig{approval}, wantErr: "approval steps require the streaming endpoint"},
+		{name: "duplicate names", agents: []AgentConfig{agent("draft"), agent("draft")}, wantErr: "agent validation failed: duplicate agent name 'draft'"},
+		{name: "unknown cache mode", agents: []AgentConfig{agent("draft")}, cache: "sometimes", wantErr: "invalid cache mode 'sometimes'"},
+		{name: "missing fields", agents: []AgentConfig{{Name: "draft", Provider: shared.PROVIDER_OPENAI}}, wantErr: "agent 1 missing required fields"},
+		{name: "unknown provider", agents: []AgentConfig{{Name: "draft", Role: "r", SystemMsg: "s", Provider: "acme"}}, wantErr: "provider 'acme' is not supported"},
+		{name: "images without vision", agents: []AgentConfig{{Name: "draft", Role: "r", SystemMsg: "s", Provider: shared.PROVIDER_COHERE}}, images: []string{"https://example.com/a.png"}, wantErr: "images require the first agent to use a vision provider"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ExecutePipelineRequest{Name: "draft", FirstPrompt: "Write", Agents: tt.agents, Cache: tt.cache, Images: tt.images, IsolateInputs: true}
+			req.providerKeys = map[string]string{shared.PROVIDER_OPENAI: "sk-test"}
+
+			req, execution, err := (&Server{}).buildManager(req, nil, tt.approvals)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if execution.ID != req.executionID || len(execution.Agents) != len(tt.agents) {
+				t.Fatalf("got execution %s with %d agents, want %s with %d", execution.ID, len(execution.Agents), req.executionID, len(tt.agents))
+			}
+			if execution.Agents[0].IsolateInput || !execution.Agents[1].IsolateInput {
+				t.Fatal("want only the agents after the first isolated")
+			}
+		})
+	}
+}
+
+func TestSubPipelinesIsolateOnlyInputFromAnotherStep(t *testing.T) {
+	agent := func(name string) AgentConfig {
+		return AgentConfig{Name: name, Role: "assistant", SystemMsg: "Help.", Provider: shared.PROVIDER_OPENAI}
+	}
+	sub := func(name string) AgentConfig {
+		return AgentConfig{Name: name, Pipeline: &ExecutePipelineRequest{Name: name, Agents: []AgentConfig{agent(name + "-inner")}}}
+	}
+
+	tests := []struct {
+		name         string
+		agents       []AgentConfig
+		wantIsolated []bool // per provider call
+	}{
+		{name: "first step", agents: []AgentConfig{sub("outline"), agent("draft")}, wantIsolated: []bool{false, true}},
+		{name: "later step", agents: []AgentConfig{agent("draft"), sub("review")}, wantIsolated: []bool{false, true}},
+		{name: "first step of a later sub-pipeline", agents: []AgentConfig{agent("draft"), {Name: "outer", Pipeline: &ExecutePipelineRequest{Name: "outer", Agents: []AgentConfig{sub("inner")}}}}, wantIsolated: []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeOpenAI{}
+			server := httptest.NewServer(provider)
+			defer server.Close()
+			t.Setenv("OPENAI_BASE_URL", server.URL)
+
+			req := ExecutePipelineRequest{Name: "report", FirstPrompt: "Write a report", Agents: tt.agents, IsolateInputs: true}
+			req.providerKeys = map[string]string{shared.PROVIDER_OPENAI: "sk-test"}
+			_, execution, err := (&Server{}).buildManager(req, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := execution.Manager.StartPipeline(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(provider.bodies) != len(tt.wantIsolated) {
+				t.Fatalf("got %d provider calls, want %d", len(provider.bodies), len(tt.wantIsolated))
+			}
+			for i, want := range tt.wantIsolated {
+				if got := strings.Contains(provider.bodies[i], "INSTRUCTIONS END HERE"); got != want {
+					t.Errorf("call %d isolated: %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompletedExecutionReleasesAgents(t *testing.T) {
+	provider := &fakeOpenAI{}
+	server := httptest.NewServer(provider)
+	defer server.Close()
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	agent := AgentConfig{Name: "draft", Role: "assistant", SystemMsg: "Help.", Provider: shared.PROVIDER_OPENAI}
+	req := ExecutePipelineRequest{Name: "draft", FirstPrompt: "Write", Agents: []AgentConfig{agent}}
+	req.providerKeys, req.workspace = map[string]string{shared.PROVIDER_OPENAI: "sk-caller"}, DEFAULT_WORKSPACE
+
+	s := &Server{executions: make(map[string]*PipelineExecution), workspaces: &workspaceStore{workspaces: make(map[string]*Workspace)}}
+	req, execution, err := s.buildManager(req, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.executions[execution.ID] = execution
+	output, err := execution.Manager.StartPipeline()
+	s.completeExecution(req, execution, output, err)
+
+	if execution.Manager != nil || execution.Agents != nil {
+		t.Fatal("completed execution still holds the agents carrying the caller's key")
+	}
+	if got := execution.status(); got != STATUS_SUCCEEDED {
+		t.Fatalf("got status %s, want %s", got, STATUS_SUCCEEDED)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/executions/"+execution.ID+"/approve", strings.NewReader(`{"decision":"approve"}`))
+	r.SetPathValue("id", execution.ID)
+	w := httptest.NewRecorder()
+	s.ApproveExecution(w, r)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d approving a completed execution, want %d", w.Code, http.StatusConflict)
+	}
+}
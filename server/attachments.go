@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/ledongthuc/pdf"
+)
+
+// Attachment is a file uploaded with an execution, converted for the first agent
+type Attachment struct {
+	Name     string
+	MIMEType string
+	Size     int
+
+	// Text holds the extracted content of documents; Data holds raw image bytes
+	Text string
+	Data []byte
+}
+
+func (a Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MIMEType, "image/")
+}
+
+// decodeExecuteRequest reads either a JSON body or a multipart form whose
+// "request" field holds the JSON and whose "files" fields hold attachments,
+// along with the caller's provider keys and workspace
+func decodeExecuteRequest(r *http.Request) (ExecutePipelineRequest, []Attachment, error) {
+	var req ExecutePipelineRequest
+
+	keys, err := readProviderKeys(r)
+	if err != nil {
+		return req, nil, err
+	}
+	req.providerKeys, req.workspace = keys, workspaceOf(r)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, nil, errors.New("invalid JSON")
+		}
+		return req, nil, nil
+	}
+
+	if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+		return req, nil, fmt.Errorf("invalid multipart upload: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(r.FormValue("request")), &req); err != nil {
+		return req, nil, errors.New("invalid JSON in 'request' field")
+	}
+
+	var attachments []Attachment
+	for _, header := range r.MultipartForm.File["files"] {
+		attachment, err := readAttachment(header)
+		if err != nil {
+			return req, nil, fmt.Errorf("attachment '%s': %v", header.Filename, err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return req, attachments, nil
+}
+
+// readAttachment converts an uploaded file to text, or keeps the bytes of an image
+func readAttachment(header *multipart.FileHeader) (Attachment, error) {
+	file, err := header.Open()
+	if err != nil {
+		return Attachment{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	attachment := Attachment{
+		Name:     header.Filename,
+		MIMEType: attachmentType(header, data),
+		Size:     len(data),
+	}
+
+	switch {
+	case attachment.IsImage():
+		attachment.Data = data
+	case attachment.MIMEType == "application/pdf":
+		attachment.Text, err = pdfToText(data)
+	case attachment.MIMEType == "text/csv":
+		attachment.Text, err = csvToText(data)
+	case utf8.Valid(data):
+		attachment.Text = string(data)
+	default:
+		err = fmt.Errorf("unsupported file type %s", attachment.MIMEType)
+	}
+
+	return attachment, err
+}
+
+// attachmentType trusts the file extension first, since browsers often send octet-stream
+func attachmentType(header *multipart.FileHeader, data []byte) string {
+	if byExtension := mime.TypeByExtension(filepath.Ext(header.Filename)); byExtension != "" {
+		mediaType, _, _ := mime.ParseMediaType(byExtension)
+		return mediaType
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+// pdfToText extracts the text of every page; the PDF library panics on some malformed
+// files, which are reported as invalid instead
+func pdfToText(data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid PDF: %w", err)
+	}
+
+	var b strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PDF page %d: %w", i, err)
+		}
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// csvToText renders each row as "column: value" lines so models keep the header context
+func csvToText(data []byte) (string, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+
+	header := rows[0]
+	var b strings.Builder
+	for i, row := range rows[1:] {
+		fmt.Fprintf(&b, "Row %d:\n", i+1)
+		for j, value := range row {
+			if j < len(header) {
+				fmt.Fprintf(&b, "%s: %s\n", header[j], value)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// withAttachmentText appends the text of document attachments to the first prompt
+func withAttachmentText(prompt string, attachments []Attachment) string {
+	var b strings.Builder
+	b.WriteString(prompt)
+	for _, attachment := range attachments {
+		if attachment.IsImage() {
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n--- ATTACHMENT: %s (%s) ---\n%s\n--- END ATTACHMENT ---", attachment.Name, attachment.MIMEType, attachment.Text)
+	}
+	return b.String()
+}
+
+// firstAgentImages collects the image URLs of the request and the uploaded images
+func firstAgentImages(req ExecutePipelineRequest, attachments []Attachment) []agents.Part {
+	var parts []agents.Part
+	for _, url := range req.Images {
+		parts = append(parts, agents.ImageURLPart(url))
+	}
+	for _, attachment := range attachments {
+		if attachment.IsImage() {
+			parts = append(parts, agents.ImagePart(attachment.MIMEType, attachment.Data))
+		}
+	}
+	return parts
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF numbers objects from 1, makes the first the catalog and writes a matching xref table
+func buildPDF(objects ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF", len(objects)+1, xref)
+	return []byte(b.String())
+}
+
+func TestPDFToText(t *testing.T) {
+	content := "BT /F1 12 Tf (Quarterly report) Tj ET"
+	catalog, pages := "<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr string
+	}{
+		{
+			name: "text page",
+			data: buildPDF(catalog, pages,
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+				fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+				"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"),
+			want: "Quarterly report",
+		},
+		{name: "not a PDF", data: []byte("hello"), wantErr: "invalid PDF"},
+		{name: "malformed page", data: buildPDF(catalog, pages, "<< /Type /Page /Contents ) >>"), wantErr: "invalid PDF: unexpected delimiter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pdfToText(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %q and error %v, want %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+)
+
+// newAuditLog opens the audit log named by the environment, or returns nil when auditing is disabled
+func newAuditLog() *audit.Log {
+	path := os.Getenv(ENV_AUDIT_FILE)
+	if path == "" {
+		return nil
+	}
+
+	auditLog, err := audit.Open(path)
+	if err != nil {
+		log.Fatalf("failed to open audit log %s: %v", path, err)
+	}
+	return auditLog
+}
+
+// recordAudit appends entry on behalf of the caller of r
+func (s *Server) recordAudit(r *http.Request, entry audit.Entry) {
+	if s.audit == nil {
+		return
+	}
+
+	entry.Actor, entry.Workspace = clientOf(r), workspaceOf(r)
+	if err := s.audit.Record(entry); err != nil {
+		log.Printf("failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
+
+// auditAgents lists every agent a pipeline can run, including nested pipelines, tools, map steps and judges
+func auditAgents(configs []AgentConfig) []audit.Agent {
+	var agents []audit.Agent
+	for _, cfg := range configs {
+		if cfg.Provider != "" {
+			agents = append(agents, audit.Agent{Name: cfg.Name, Provider: cfg.Provider, Model: cfg.Model, Credential: cfg.Credential})
+		}
+		if cfg.Pipeline != nil {
+			agents = append(agents, auditAgents(cfg.Pipeline.Agents)...)
+		}
+		if m := cfg.Map; m != nil {
+			if m.Agent != nil {
+				agents = append(agents, auditAgents([]AgentConfig{*m.Agent})...)
+			}
+			if m.Pipeline != nil {
+				agents = append(agents, auditAgents(m.Pipeline.Agents)...)
+			}
+			if m.Reducer != nil {
+				agents = append(agents, auditAgents([]AgentConfig{*m.Reducer})...)
+			}
+		}
+		for _, tool := range cfg.Tools {
+			if tool.Pipeline != nil {
+				agents = append(agents, auditAgents(tool.Pipeline.Agents)...)
+			}
+		}
+		for _, guardrail := range cfg.Guardrails {
+			if guardrail.Judge != nil {
+				agents = append(agents, auditAgents([]AgentConfig{*guardrail.Judge})...)
+			}
+		}
+	}
+	return agents
+}
+
+// QueryAudit returns audit entries filtered by from, to (RFC 3339), actor, pipeline and action.
+// Operators may also filter by workspace; everyone else sees only their own workspace.
+func (s *Server) QueryAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.auditEnabled(w) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:     query.Get("actor"),
+		Pipeline:  query.Get("pipeline"),
+		Action:    query.Get("action"),
+		Workspace: query.Get("workspace"),
+	}
+	if !isOperator(r) {
+		filter.Workspace = workspaceOf(r)
+	}
+
+	for name, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid '%s', expected an RFC 3339 time", name))
+				return
+			}
+			*bound = parsed
+		}
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read audit log: %v", err))
+		return
+	}
+	s.sendJSON(w, http.StatusOK, entries)
+}
+
+// VerifyAudit checks the hash chain of the whole audit log; operators only
+func (s *Server) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.auditEnabled(w) {
+		return
+	}
+	if !isOperator(r) {
+		s.sendError(w, http.StatusForbidden, fmt.Sprintf("Only admin keys of the '%s' workspace verify the audit log", DEFAULT_WORKSPACE))
+		return
+	}
+
+	entries, err := s.audit.Verify()
+	response := map[string]interface{}{"valid": err == nil, "entries": entries}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	s.sendJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) auditEnabled(w http.ResponseWriter) bool {
+	if s.audit == nil {
+		s.sendError(w, http.StatusServiceUnavailable, fmt.Sprintf("Auditing is disabled: set %s", ENV_AUDIT_FILE))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+)
+
+// APIKey is a bearer token allowed to call the endpoints of its scopes within its workspace.
+// Only the SHA-256 hash of the token is kept.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Workspace string    `json:"workspace,omitempty"` // empty for keys created before workspaces
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// bootstrapKey stands for the PROMPTMESH_ADMIN_KEY token
+var bootstrapKey = &APIKey{ID: "admin", Name: "bootstrap", Scopes: []string{SCOPE_ADMIN}}
+
+type apiKeyContextKey struct{}
+
+// requestKey returns the API key that authenticated r, or nil when authentication is disabled
+func requestKey(r *http.Request) *APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+func (k *APIKey) allows(scope string) bool {
+	return slices.Contains(k.Scopes, SCOPE_ADMIN) || slices.Contains(k.Scopes, scope)
+}
+
+func (k *APIKey) workspace() string {
+	if k.Workspace == "" {
+		return DEFAULT_WORKSPACE
+	}
+	return k.Workspace
+}
+
+// workspaceOf returns the workspace of the key that authenticated r
+func workspaceOf(r *http.Request) string {
+	if key := requestKey(r); key != nil {
+		return key.workspace()
+	}
+	return DEFAULT_WORKSPACE
+}
+
+// isOperator reports whether r may manage every workspace: it carries an admin key
+// of the default workspace, or authentication is disabled
+func isOperator(r *http.Request) bool {
+	key := requestKey(r)
+	return key == nil || (key.workspace() == DEFAULT_WORKSPACE && key.allows(SCOPE_ADMIN))
+}
+
+// keyStore holds the API keys, persisted as a JSON file
+type keyStore struct {
+	path  string
+	keys  map[string]*APIKey // by hash
+	mutex sync.RWMutex
+}
+
+// newKeyStore loads the keys file named by the environment, or returns nil
+// when it is unset and authentication is disabled
+func newKeyStore() *keyStore {
+	path := os.Getenv(ENV_API_KEYS_FILE)
+	if path == "" {
+		return nil
+	}
+
+	store := &keyStore{path: path, keys: make(map[string]*APIKey)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store
+	}
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", path, err)
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		log.Fatalf("invalid keys file %s: %v", path, err)
+	}
+	for _, key := range keys {
+		store.keys[key.Hash] = key
+	}
+	return store
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ks *keyStore) lookup(token string) *APIKey {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+	return ks.keys[hashToken(token)]
+}
+
+// create adds a key and returns its token, which is not stored and cannot be shown again
+func (ks *keyStore) create(name string, scopes []string, workspace string) (*APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := API_KEY_TOKEN_PREFIX + hex.EncodeToString(secret)
+
+	key := &APIKey{
+		ID:        generateID(API_KEY_PREFIX),
+		Name:      name,
+		Hash:      hashToken(token),
+		Scopes:    scopes,
+		Workspace: workspace,
+		CreatedAt: time.Now(),
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.keys[key.Hash] = key
+	if err := ks.save(); err != nil {
+		delete(ks.keys, key.Hash)
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// revoke deletes a key; an empty workspace matches keys of any workspace
+func (ks *keyStore) revoke(id, workspace string) (bool, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	for hash, key := range ks.keys {
+		if key.ID == id && (workspace == "" || key.workspace() == workspace) {
+			delete(ks.keys, hash)
+			return true, ks.save()
+		}
+	}
+	return false, nil
+}
+
+func (ks *keyStore) list() []*APIKey {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	keys := make([]*APIKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b *APIKey) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return keys
+}
+
+// save writes the keys file; callers hold the write lock
+func (ks *keyStore) save() error {
+	keys := make([]*APIKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ks.path, data, 0o600)
+}
+
+// requireScope rejects requests without a bearer token carrying scope.
+// It lets everything through while authentication is disabled.
+func (s *Server) requireScope(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.keys == nil {
+			handler(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.sendError(w, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		key := s.keys.lookup(token)
+		if admin := os.Getenv(ENV_ADMIN_KEY); admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+			key = bootstrapKey
+		}
+		if key == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.sendError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if !key.allows(scope) {
+			s.sendError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the '%s' scope", scope))
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// ManageKeys lists API keys (GET) or creates one (POST)
+func (s *Server) ManageKeys(w http.ResponseWriter, r *http.Request) {
+	if s.keys == nil {
+		s.sendError(w, http.StatusServiceUnavailable, fmt.Sprintf("Authentication is disabled: set %s", ENV_API_KEYS_FILE))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys := []APIKeyResponse{}
+		for _, key := range s.keys.list() {
+			if isOperator(r) || key.workspace() == workspaceOf(r) {
+				keys = append(keys, newAPIKeyResponse(key, ""))
+			}
+		}
+		s.sendJSON(w, http.StatusOK, keys)
+
+	case http.MethodPost:
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Name == "" || len(req.Scopes) == 0 {
+			s.sendError(w, http.StatusBadRequest, "Missing required fields: name, scopes")
+			return
+		}
+		for _, scope := range req.Scopes {
+			if scope != SCOPE_RUN && scope != SCOPE_READ && scope != SCOPE_ADMIN {
+				s.sendError(w, http.StatusBadRequest, fmt.Sprintf("invalid scope '%s', expected %s, %s or %s", scope, SCOPE_RUN, SCOPE_READ, SCOPE_ADMIN))
+				return
+			}
+		}
+
+		if req.Workspace == "" {
+			req.Workspace = workspaceOf(r)
+		}
+		if req.Workspace != workspaceOf(r) && !isOperator(r) {
+			s.sendError(w, http.StatusForbidden, "API key cannot create keys in another workspace")
+			return
+		}
+		if _, ok := s.workspaces.get(req.Workspace); !ok {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Workspace '%s' not found", req.Workspace))
+			return
+		}
+
+		key, token, err := s.keys.create(req.Name, req.Scopes, req.Workspace)
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create API key: %v", err))
+			return
+		}
+		s.recordAudit(r, audit.Entry{Action: AUDIT_KEY_CREATE, Target: key.ID, Detail: fmt.Sprintf("workspace %s, scopes %s", key.Workspace, strings.Join(key.Scopes, ","))})
+		s.sendJSON(w, http.StatusCreated, newAPIKeyResponse(key, token))
+
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// RevokeKey deletes an API key
+func (s *Server) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.keys == nil {
+		s.sendError(w, http.StatusServiceUnavailable, fmt.Sprintf("Authentication is disabled: set %s", ENV_API_KEYS_FILE))
+		return
+	}
+
+	workspace := workspaceOf(r)
+	if isOperator(r) {
+		workspace = ""
+	}
+
+	id := r.PathValue("id")
+	found, err := s.keys.revoke(id, workspace)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke API key: %v", err))
+		return
+	}
+	if !found {
+		s.sendError(w, http.StatusNotFound, fmt.Sprintf("API key '%s' not found", id))
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_KEY_REVOKE, Target: id})
+	s.sendJSON(w, http.StatusOK, map[string]string{"id": id, "message": "API key revoked"})
+}
+
+func newAPIKeyResponse(key *APIKey, token string) APIKeyResponse {
+	return APIKeyResponse{ID: key.ID, Name: key.Name, Scopes: key.Scopes, Workspace: key.workspace(), CreatedAt: key.CreatedAt, Key: token}
+}
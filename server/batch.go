@@ -0,0 +1,357 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
+	"github.com/AlexsanderHamir/PromptMesh/tracing"
+)
+
+// ExecuteBatch runs a pipeline over every row of an uploaded CSV or JSONL dataset,
+// streaming per-row progress via Server-Sent Events
+func (s *Server) ExecuteBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid multipart upload: %v", err))
+		return
+	}
+
+	var req BatchRequest
+	if err := json.Unmarshal([]byte(r.FormValue("request")), &req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid JSON in 'request' field")
+		return
+	}
+
+	keys, err := readProviderKeys(r)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.providerKeys, req.workspace = keys, workspaceOf(r)
+
+	if req.Name == "" || len(req.Agents) == 0 {
+		s.sendError(w, http.StatusBadRequest, "Missing required fields: name, agents")
+		return
+	}
+
+	if err := validateCacheMode(req.Cache); err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Concurrency > MAX_BATCH_CONCURRENCY {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("concurrency must be at most %d", MAX_BATCH_CONCURRENCY))
+		return
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = DEFAULT_BATCH_CONCURRENCY
+	}
+
+	prompts, err := readBatchPrompts(r, req.FirstPrompt)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cassette, err := openCassette(req.ExecutePipelineRequest)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Cassette unavailable: %v", err))
+		return
+	}
+
+	batchID := generateID(BATCH_PREFIX)
+	req.executionID = batchID
+
+	// Build the pipeline once up front so configuration errors are reported before streaming
+	if _, err := s.newNestedManager(req.ExecutePipelineRequest, cassette); err != nil {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Pipeline validation failed: %v", err))
+		return
+	}
+
+	s.recordAudit(r, audit.Entry{Action: AUDIT_BATCH_RUN, Pipeline: req.Name, ExecutionID: batchID, Agents: auditAgents(req.Agents), Detail: fmt.Sprintf("%d rows", len(prompts))})
+
+	// Set up SSE headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	batch := &Batch{
+		ID:        batchID,
+		Workspace: req.workspace,
+		Results:   make([]BatchResult, len(prompts)),
+		CreatedAt: time.Now(),
+	}
+
+	s.sendSSEMessage(w, "status", map[string]interface{}{
+		"type":     "batch_started",
+		"batch_id": batch.ID,
+		"total":    len(prompts),
+		"message":  fmt.Sprintf("🚀 Running pipeline '%s' over %d row(s)", req.Name, len(prompts)),
+	})
+
+	pipeline := metrics.Pipelines.Value(req.Name)
+	metrics.ActiveStreams.Inc(pipeline)
+	defer metrics.ActiveStreams.Dec(pipeline)
+
+	// Rows run concurrently; their results are streamed from this goroutine only
+	ctx, span := tracing.StartRequest(r, "ExecuteBatch", requestAttributes(req.ExecutePipelineRequest)...)
+	done := s.startBatchRows(ctx, req, cassette, prompts)
+
+	failed := 0
+	for completed := 1; completed <= len(prompts); completed++ {
+		result := <-done
+		batch.Results[result.Row-1] = result
+
+		message := fmt.Sprintf("✅ Row %d finished (%d/%d)", result.Row, completed, len(prompts))
+		if result.Error != "" {
+			failed++
+			message = fmt.Sprintf("❌ Row %d failed (%d/%d): %s", result.Row, completed, len(prompts), result.Error)
+		}
+
+		s.sendSSEMessage(w, "row_completed", map[string]interface{}{
+			"row":        result.Row,
+			"completed":  completed,
+			"total":      len(prompts),
+			"error":      result.Error,
+			"latency_ms": result.LatencyMS,
+			"message":    message,
+		})
+	}
+	tracing.End(span, ctx.Err())
+	saveCassette(req.ExecutePipelineRequest, cassette)
+
+	s.mutex.Lock()
+	s.batches[batch.ID] = batch
+	s.mutex.Unlock()
+
+	s.sendSSEMessage(w, "status", map[string]interface{}{
+		"type":      "batch_completed",
+		"batch_id":  batch.ID,
+		"succeeded": len(prompts) - failed,
+		"failed":    failed,
+		"results":   fmt.Sprintf("/api/batches/%s/results", batch.ID),
+		"message":   fmt.Sprintf("🎉 Batch finished: %d succeeded, %d failed", len(prompts)-failed, failed),
+	})
+	s.sendSSEMessage(w, "end", map[string]interface{}{
+		"type":     "batch_end",
+		"batch_id": batch.ID,
+	})
+}
+
+// startBatchRows runs up to req.Concurrency rows at a time and delivers every row's result;
+// once ctx is done, rows not yet started fail without running
+func (s *Server) startBatchRows(ctx context.Context, req BatchRequest, cassette *agents.Cassette, prompts []string) <-chan BatchResult {
+	done := make(chan BatchResult)
+	limit := make(chan struct{}, req.Concurrency)
+	go func() {
+		for i, prompt := range prompts {
+			if ctx.Err() == nil {
+				select {
+				case limit <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				done <- BatchResult{Row: i + 1, Input: prompt, Error: fmt.Sprintf("not run: %v", ctx.Err())}
+				continue
+			}
+			go func() {
+				defer func() { <-limit }()
+				done <- s.runBatchRow(ctx, req.ExecutePipelineRequest, cassette, i+1, prompt)
+			}()
+		}
+	}()
+	return done
+}
+
+// runBatchRow runs the pipeline on one prompt with freshly built agents, tracing it under ctx
+func (s *Server) runBatchRow(ctx context.Context, req ExecutePipelineRequest, cassette *agents.Cassette, row int, prompt string) BatchResult {
+	result := BatchResult{Row: row, Input: prompt}
+	start := time.Now()
+
+	manager, err := s.newNestedManager(req, cassette)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	manager.FirstPrompt = prompt
+	manager.Context = ctx
+
+	output, err := manager.StartPipeline()
+	recordExecution(req.Name, start, err)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	usage := manager.Usage()
+	result.PromptTokens, result.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+	s.workspaces.record(req.workspace, usage)
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Output = output.Text
+	return result
+}
+
+// readBatchPrompts renders one prompt per row of the uploaded "dataset" file
+func readBatchPrompts(r *http.Request, template string) ([]string, error) {
+	file, header, err := r.FormFile("dataset")
+	if err != nil {
+		return nil, errors.New("No dataset uploaded in field 'dataset'")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read dataset: %v", err)
+	}
+
+	rows, err := readDataset(header.Filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid dataset: %v", err)
+	}
+	if len(rows) == 0 || len(rows) > MAX_BATCH_ROWS {
+		return nil, fmt.Errorf("Dataset must have between 1 and %d rows", MAX_BATCH_ROWS)
+	}
+
+	prompts := make([]string, len(rows))
+	for i, row := range rows {
+		prompts[i] = renderPrompt(template, row)
+		if strings.TrimSpace(prompts[i]) == "" {
+			return nil, fmt.Errorf("Row %d has an empty prompt", i+1)
+		}
+	}
+	return prompts, nil
+}
+
+// readDataset parses a CSV file with a header row, or a JSONL file of objects
+func readDataset(name string, data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		columns := records[0]
+		for _, record := range records[1:] {
+			row := make(map[string]string, len(columns))
+			for i, column := range columns {
+				if i < len(record) {
+					row[column] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	case ".jsonl", ".ndjson":
+		for i, line := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var object map[string]any
+			if err := json.Unmarshal([]byte(line), &object); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			row := make(map[string]string, len(object))
+			for key, value := range object {
+				if text, ok := value.(string); ok {
+					row[key] = text
+					continue
+				}
+				raw, _ := json.Marshal(value)
+				row[key] = string(raw)
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, errors.New("expected a .csv or .jsonl file")
+	}
+
+	return rows, nil
+}
+
+// renderPrompt fills the {{column}} placeholders of template from the row;
+// without a template the row's input column is the prompt
+func renderPrompt(template string, row map[string]string) string {
+	if template == "" {
+		return row[BATCH_INPUT_COLUMN]
+	}
+
+	var replacements []string
+	for column, value := range row {
+		replacements = append(replacements, "{{"+column+"}}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// DownloadBatch returns the results of a finished batch as JSONL (default) or CSV
+func (s *Server) DownloadBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := r.PathValue("id")
+	s.mutex.RLock()
+	batch, ok := s.batches[id]
+	s.mutex.RUnlock()
+	if !ok || batch.Workspace != workspaceOf(r) {
+		s.sendError(w, http.StatusNotFound, fmt.Sprintf("Batch '%s' not found", id))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FORMAT_JSONL
+	}
+
+	switch format {
+	case FORMAT_JSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", batch.ID))
+		encoder := json.NewEncoder(w)
+		for _, result := range batch.Results {
+			encoder.Encode(result)
+		}
+	case FORMAT_CSV:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", batch.ID))
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"row", "input", "output", "error", "latency_ms", "prompt_tokens", "completion_tokens"})
+		for _, result := range batch.Results {
+			writer.Write([]string{
+				strconv.Itoa(result.Row),
+				result.Input,
+				result.Output,
+				result.Error,
+				strconv.FormatInt(result.LatencyMS, 10),
+				strconv.Itoa(result.PromptTokens),
+				strconv.Itoa(result.CompletionTokens),
+			})
+		}
+		writer.Flush()
+	default:
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("format must be '%s' or '%s'", FORMAT_JSONL, FORMAT_CSV))
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBatchRowsStopWithTheRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := &Server{}
+	prompts := []string{"first", "second", "third"}
+	done := s.startBatchRows(ctx, BatchRequest{Concurrency: 2}, nil, prompts)
+
+	rows := make(map[int]bool)
+	for range prompts {
+		result := <-done
+		if !strings.HasPrefix(result.Error, "not run: context canceled") {
+			t.Fatalf("row %d got error %q, want it skipped", result.Row, result.Error)
+		}
+		rows[result.Row] = true
+	}
+	if len(rows) != len(prompts) {
+		t.Fatalf("got results for rows %v, want one per prompt", rows)
+	}
+}
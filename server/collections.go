@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/rag"
+)
+
+// ListCollections returns the workspace's document collections and their chunk counts
+func (s *Server) ListCollections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if s.rag == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "Document collections are disabled: no embedding provider configured")
+		return
+	}
+
+	workspace := workspaceOf(r)
+	collections := []CollectionResponse{}
+	for stored, chunks := range s.rag.Counts() {
+		name, ok := stored, !strings.Contains(stored, WORKSPACE_SEPARATOR)
+		if workspace != DEFAULT_WORKSPACE {
+			name, ok = strings.CutPrefix(stored, workspace+WORKSPACE_SEPARATOR)
+		}
+		if ok {
+			collections = append(collections, CollectionResponse{Name: name, Chunks: chunks})
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+
+	s.sendJSON(w, http.StatusOK, collections)
+}
+
+// validateCollectionName rejects names that are not plain file names or that would reach
+// into another workspace's collections
+func validateCollectionName(name string) error {
+	if err := rag.ValidateName(name); err != nil {
+		return err
+	}
+	if strings.Contains(name, WORKSPACE_SEPARATOR) {
+		return fmt.Errorf("collection name cannot contain '%s'", WORKSPACE_SEPARATOR)
+	}
+	return nil
+}
+
+// UploadDocuments chunks, embeds and stores the text files of a multipart upload
+func (s *Server) UploadDocuments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if s.rag == nil {
+		s.sendError(w, http.StatusServiceUnavailable, "Document collections are disabled: no embedding provider configured")
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := validateCollectionName(name); err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	collection := collectionName(workspaceOf(r), name)
+
+	if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid multipart upload: %v", err))
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		s.sendError(w, http.StatusBadRequest, "No files uploaded in field 'files'")
+		return
+	}
+
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read '%s': %v", header.Filename, err))
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read '%s': %v", header.Filename, err))
+			return
+		}
+
+		if !utf8.Valid(data) {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("File '%s' is not UTF-8 text", header.Filename))
+			return
+		}
+
+		if _, err := s.rag.AddDocument(r.Context(), collection, header.Filename, string(data)); err != nil {
+			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to index '%s': %v", header.Filename, err))
+			return
+		}
+	}
+
+	s.recordAudit(r, audit.Entry{Action: AUDIT_COLLECTION_UPLOAD, Target: name, Detail: fmt.Sprintf("%d files", len(files))})
+	s.sendJSON(w, http.StatusOK, CollectionResponse{Name: name, Chunks: s.rag.Counts()[collection]})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/metrics"
+	"github.com/AlexsanderHamir/PromptMesh/orchestration"
+	"github.com/AlexsanderHamir/PromptMesh/tracing"
+)
+
+// ComparePipelines runs the same input through several pipeline variants concurrently,
+// streaming their events tagged by variant and ending with a side-by-side comparison
+func (s *Server) ComparePipelines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req CompareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if req.Name == "" || req.FirstPrompt == "" {
+		s.sendError(w, http.StatusBadRequest, "Missing required fields: name, first_prompt")
+		return
+	}
+
+	if len(req.Variants) < 2 || len(req.Variants) > MAX_VARIANTS {
+		s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Between 2 and %d variants are required", MAX_VARIANTS))
+		return
+	}
+
+	keys, err := readProviderKeys(r)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	executionID := generateID(PIPELINE_PREFIX)
+	seen := make(map[string]bool)
+	managers := make([]*orchestration.AgentManager, len(req.Variants))
+	cassettes := make([]*agents.Cassette, len(req.Variants))
+	for i, variant := range req.Variants {
+		if variant.Name == "" || seen[variant.Name] {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Variant %d needs a unique name", i+1))
+			return
+		}
+		seen[variant.Name] = true
+		variant.providerKeys, variant.executionID, variant.workspace = keys, executionID, workspaceOf(r)
+		req.Variants[i] = variant // its cassette is saved under the workspace afterwards
+
+		if err := validateCacheMode(variant.Cache); err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Variant '%s': %v", variant.Name, err))
+			return
+		}
+
+		cassette, err := openCassette(variant)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Variant '%s': cassette unavailable: %v", variant.Name, err))
+			return
+		}
+		cassettes[i] = cassette
+
+		manager, err := s.newNestedManager(variant, cassette)
+		if err != nil {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Variant '%s': %v", variant.Name, err))
+			return
+		}
+		manager.FirstPrompt = req.FirstPrompt
+		manager.Variant = variant.Name
+		managers[i] = manager
+	}
+
+	var variantAgents []AgentConfig
+	for _, variant := range req.Variants {
+		variantAgents = append(variantAgents, variant.Agents...)
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_COMPARE_RUN, Pipeline: req.Name, ExecutionID: executionID, Agents: auditAgents(variantAgents)})
+
+	// Set up SSE headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	s.sendSSEMessage(w, "status", map[string]interface{}{
+		"type":         "comparison_started",
+		"execution_id": executionID,
+		"message":      fmt.Sprintf("🚀 Comparing %d variants of '%s'", len(req.Variants), req.Name),
+	})
+
+	// Variants stop with the request and trace under one root span
+	attributes := requestAttributes(ExecutePipelineRequest{Name: req.Name, Agents: variantAgents, executionID: executionID, workspace: workspaceOf(r)})
+	ctx, span := tracing.StartRequest(r, "ComparePipelines", attributes...)
+	for _, manager := range managers {
+		manager.Context = ctx
+	}
+
+	pipeline := metrics.Pipelines.Value(req.Name)
+	metrics.ActiveStreams.Inc(pipeline)
+	results := orchestration.RunVariants(w, managers)
+	metrics.ActiveStreams.Dec(pipeline)
+	tracing.End(span, ctx.Err())
+
+	comparison := make([]VariantComparison, len(results))
+	for i, result := range results {
+		saveCassette(req.Variants[i], cassettes[i])
+		s.workspaces.record(workspaceOf(r), result.Usage)
+
+		comparison[i] = VariantComparison{
+			Variant:   result.Variant,
+			LatencyMS: result.Latency.Milliseconds(),
+			Usage:     result.Usage,
+		}
+		if result.Err != nil {
+			comparison[i].Error = result.Err.Error()
+		} else {
+			comparison[i].Result = result.Output.Text
+		}
+	}
+
+	s.sendSSEMessage(w, "status", map[string]interface{}{
+		"type":       "comparison_completed",
+		"message":    fmt.Sprintf("🎉 Comparison of '%s' finished", req.Name),
+		"comparison": comparison,
+	})
+	s.sendSSEMessage(w, "end", map[string]interface{}{
+		"type":         "pipeline_end",
+		"execution_id": executionID,
+	})
+}
@@ -1,5 +1,160 @@
 package server
 
+import "time"
+
 const (
 	PIPELINE_PREFIX = "pipeline"
+	BATCH_PREFIX    = "batch"
+	API_KEY_PREFIX  = "key"
+	EVAL_PREFIX     = "eval"
+
+	// API_KEY_TOKEN_PREFIX marks bearer tokens issued by the server
+	API_KEY_TOKEN_PREFIX = "pm_"
+)
+
+// PROVIDER_KEY_HEADER carries a caller's own provider key as <provider>=<key>
+const PROVIDER_KEY_HEADER = "X-Provider-Key"
+
+// API key scopes; admin grants every scope
+const (
+	SCOPE_RUN   = "run"
+	SCOPE_READ  = "read"
+	SCOPE_ADMIN = "admin"
+)
+
+// DEFAULT_WORKSPACE owns everything created without a workspace, including the
+// data of single-tenant deployments; its admin keys operate every workspace
+const DEFAULT_WORKSPACE = "default"
+
+// WORKSPACE_SEPARATOR joins a workspace and a collection name in the shared collection store
+const WORKSPACE_SEPARATOR = "~"
+
+// Audited actions
+const (
+	AUDIT_PIPELINE_RUN      = "pipeline.run"
+	AUDIT_BATCH_RUN         = "batch.run"
+	AUDIT_COMPARE_RUN       = "compare.run"
+	AUDIT_EVALUATION_RUN    = "evaluation.run"
+	AUDIT_EXECUTION_APPROVE = "execution.approve"
+	AUDIT_KEY_CREATE        = "key.create"
+	AUDIT_KEY_REVOKE        = "key.revoke"
+	AUDIT_CREDENTIAL_CREATE = "credential.create"
+	AUDIT_CREDENTIAL_ROTATE = "credential.rotate"
+	AUDIT_CREDENTIAL_DELETE = "credential.delete"
+	AUDIT_WORKSPACE_CREATE  = "workspace.create"
+	AUDIT_COLLECTION_UPLOAD = "collection.upload"
+)
+
+// Execution statuses; the finished ones are also the outcomes in metrics
+const (
+	STATUS_RUNNING           = "running"
+	STATUS_AWAITING_APPROVAL = "awaiting_approval"
+	STATUS_SUCCEEDED         = "succeeded"
+	STATUS_FAILED            = "failed"
+)
+
+// Approval decisions
+const (
+	DECISION_APPROVE = "approve"
+	DECISION_REJECT  = "reject"
+)
+
+// Environment variables that configure the server.
+const (
+	ENV_CACHE_DIR = "PROMPTMESH_CACHE_DIR" // enables the on-disk response cache
+	ENV_CACHE_TTL = "PROMPTMESH_CACHE_TTL" // e.g. "24h"
+
+	ENV_CASSETTE_DIR = "PROMPTMESH_CASSETTE_DIR" // where cassettes are recorded and replayed from
+
+	// Comma-separated allowlists; the matching tool is unavailable while its list is empty
+	ENV_HTTP_ALLOWLIST  = "PROMPTMESH_HTTP_ALLOWLIST"  // hosts for http_get
+	ENV_SHELL_ALLOWLIST = "PROMPTMESH_SHELL_ALLOWLIST" // commands for shell
+
+	ENV_RAG_DIR            = "PROMPTMESH_RAG_DIR"            // where document collections are stored
+	ENV_EMBEDDING_PROVIDER = "PROMPTMESH_EMBEDDING_PROVIDER" // defaults to openai
+	ENV_EMBEDDING_MODEL    = "PROMPTMESH_EMBEDDING_MODEL"    // defaults per provider
+
+	ENV_API_KEYS_FILE = "PROMPTMESH_API_KEYS_FILE" // enables authentication; API keys are stored here
+	ENV_ADMIN_KEY     = "PROMPTMESH_ADMIN_KEY"     // bootstrap token with every scope
+
+	ENV_MASTER_KEY  = "PROMPTMESH_MASTER_KEY"  // base64 AES-256 key; enables stored credentials
+	ENV_SECRETS_DIR = "PROMPTMESH_SECRETS_DIR" // where encrypted credentials are stored
+
+	// Per-provider limits as comma-separated provider=n pairs, e.g. "openai=4,anthropic=2"
+	ENV_PROVIDER_CONCURRENCY = "PROMPTMESH_PROVIDER_CONCURRENCY"
+	ENV_PROVIDER_RPM         = "PROMPTMESH_PROVIDER_RPM"
+
+	ENV_CLIENT_RPM   = "PROMPTMESH_CLIENT_RPM"   // execution requests per minute per API key or IP; 0 disables
+	ENV_CLIENT_BURST = "PROMPTMESH_CLIENT_BURST" // requests a client may make at once
+
+	ENV_WORKSPACES_FILE = "PROMPTMESH_WORKSPACES_FILE" // where workspaces and their usage are stored; in memory when unset
+
+	ENV_AUDIT_FILE = "PROMPTMESH_AUDIT_FILE" // enables the hash-chained audit log, appended to this JSONL file
+
+	ENV_TRACE_EXPORTER = "PROMPTMESH_TRACE_EXPORTER" // otlp, stdout or file; tracing is off when unset
+	ENV_OTLP_ENDPOINT  = "PROMPTMESH_OTLP_ENDPOINT"  // e.g. http://localhost:4318, overriding OTEL_EXPORTER_OTLP_ENDPOINT
+	ENV_TRACE_FILE     = "PROMPTMESH_TRACE_FILE"     // where the file exporter appends spans
+
+	ENV_LOG_LEVEL  = "PROMPTMESH_LOG_LEVEL"  // debug, info, warn or error; debug adds truncated prompt and response text
+	ENV_LOG_FORMAT = "PROMPTMESH_LOG_FORMAT" // text or json
+)
+
+// Log formats
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+const (
+	DEFAULT_CLIENT_RPM   = 0
+	DEFAULT_CLIENT_BURST = 10
+)
+
+const DEFAULT_CACHE_TTL = 24 * time.Hour
+
+const DEFAULT_CASSETTE_DIR = "cassettes"
+
+const DEFAULT_SECRETS_DIR = "credentials"
+
+// DEFAULT_OUTPUT_RETRIES is how often an agent is re-prompted after its
+// structured output fails schema validation.
+const DEFAULT_OUTPUT_RETRIES = 2
+
+const (
+	DEFAULT_RAG_DIR = "collections"
+	DEFAULT_TOP_K   = 4
+
+	// MAX_UPLOAD_SIZE bounds a single multipart upload
+	MAX_UPLOAD_SIZE = 32 << 20
+)
+
+// MAX_MAP_CONCURRENCY bounds how many items of a map step run at once
+const MAX_MAP_CONCURRENCY = 16
+
+const (
+	DEFAULT_BATCH_CONCURRENCY = 4
+	MAX_BATCH_CONCURRENCY     = 16
+	MAX_BATCH_ROWS            = 1000
+
+	// BATCH_INPUT_COLUMN is the dataset column used as the prompt when a batch has no template
+	BATCH_INPUT_COLUMN = "input"
+)
+
+// Batch result download formats
+const (
+	FORMAT_JSONL = "jsonl"
+	FORMAT_CSV   = "csv"
+)
+
+// MAX_VARIANTS bounds how many pipeline variants one comparison runs
+const MAX_VARIANTS = 5
+
+// Guardrail types
+const (
+	GUARDRAIL_DENY       = "deny"
+	GUARDRAIL_PII        = "pii"
+	GUARDRAIL_MAX_LENGTH = "max_length"
+	GUARDRAIL_JSON       = "json"
+	GUARDRAIL_JUDGE      = "judge"
+	GUARDRAIL_INJECTION  = "injection"
 )
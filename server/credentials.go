@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/secrets"
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+)
+
+// revealCredential returns the stored key an agent references from the request's workspace,
+// recording its use by the execution
+func (s *Server) revealCredential(cfg AgentConfig, req ExecutePipelineRequest) (string, error) {
+	if s.secrets == nil {
+		return "", fmt.Errorf("stored credentials are disabled: set %s", ENV_MASTER_KEY)
+	}
+
+	key, err := s.secrets.Reveal(credentialOwner(req.workspace), cfg.Credential, cfg.Provider, req.executionID)
+	if err != nil {
+		return "", fmt.Errorf("credential '%s': %w", cfg.Credential, err)
+	}
+	return key, nil
+}
+
+// credentialOwner is the workspace a credential is stored under; the default
+// workspace keeps the credentials stored before workspaces existed
+func credentialOwner(workspace string) string {
+	if workspace == DEFAULT_WORKSPACE {
+		return ""
+	}
+	return workspace
+}
+
+// ManageCredentials lists the workspace's stored credentials (GET) or stores a new one (POST)
+func (s *Server) ManageCredentials(w http.ResponseWriter, r *http.Request) {
+	if !s.secretsEnabled(w) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		credentials := []CredentialResponse{}
+		for _, credential := range s.secrets.List(credentialOwner(workspaceOf(r))) {
+			credentials = append(credentials, newCredentialResponse(&credential))
+		}
+		s.sendJSON(w, http.StatusOK, credentials)
+
+	case http.MethodPost:
+		var req CredentialRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Name == "" || req.Provider == "" || req.Key == "" {
+			s.sendError(w, http.StatusBadRequest, "Missing required fields: name, provider, key")
+			return
+		}
+		if _, ok := shared.ProviderEnvVars[req.Provider]; !ok {
+			s.sendError(w, http.StatusBadRequest, fmt.Sprintf("Provider '%s' is not supported. Supported providers: %s", req.Provider, getSupportedProviders()))
+			return
+		}
+
+		credential, err := s.secrets.Create(credentialOwner(workspaceOf(r)), req.Name, req.Provider, req.Key)
+		if errors.Is(err, secrets.ErrExists) {
+			s.sendError(w, http.StatusConflict, fmt.Sprintf("Credential '%s' already exists; rotate it instead", req.Name))
+			return
+		}
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to store credential: %v", err))
+			return
+		}
+		s.recordAudit(r, audit.Entry{Action: AUDIT_CREDENTIAL_CREATE, Target: credential.Name, Detail: credential.Provider})
+		s.sendJSON(w, http.StatusCreated, newCredentialResponse(credential))
+
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// RotateCredential replaces the key of a stored credential
+func (s *Server) RotateCredential(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.secretsEnabled(w) {
+		return
+	}
+
+	var req CredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" {
+		s.sendError(w, http.StatusBadRequest, "Missing required field: key")
+		return
+	}
+
+	name := r.PathValue("name")
+	credential, err := s.secrets.Rotate(credentialOwner(workspaceOf(r)), name, req.Key)
+	if errors.Is(err, secrets.ErrNotFound) {
+		s.sendError(w, http.StatusNotFound, fmt.Sprintf("Credential '%s' not found", name))
+		return
+	}
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to rotate credential: %v", err))
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_CREDENTIAL_ROTATE, Target: name, Detail: fmt.Sprintf("version %d", credential.Version)})
+	s.sendJSON(w, http.StatusOK, newCredentialResponse(credential))
+}
+
+// DeleteCredential removes a stored credential
+func (s *Server) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.secretsEnabled(w) {
+		return
+	}
+
+	name := r.PathValue("name")
+	err := s.secrets.Delete(credentialOwner(workspaceOf(r)), name)
+	if errors.Is(err, secrets.ErrNotFound) {
+		s.sendError(w, http.StatusNotFound, fmt.Sprintf("Credential '%s' not found", name))
+		return
+	}
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete credential: %v", err))
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_CREDENTIAL_DELETE, Target: name})
+	s.sendJSON(w, http.StatusOK, map[string]string{"name": name, "message": "Credential deleted"})
+}
+
+// CredentialUses lists which executions used a credential, and with which version
+func (s *Server) CredentialUses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.secretsEnabled(w) {
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, s.secrets.Uses(credentialOwner(workspaceOf(r)), r.PathValue("name")))
+}
+
+func (s *Server) secretsEnabled(w http.ResponseWriter) bool {
+	if s.secrets == nil {
+		s.sendError(w, http.StatusServiceUnavailable, fmt.Sprintf("Stored credentials are disabled: set %s", ENV_MASTER_KEY))
+		return false
+	}
+	return true
+}
+
+func newCredentialResponse(credential *secrets.Credential) CredentialResponse {
+	return CredentialResponse{
+		Name:      credential.Name,
+		Provider:  credential.Provider,
+		Version:   credential.Version,
+		CreatedAt: credential.CreatedAt,
+		RotatedAt: credential.RotatedAt,
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/eval"
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+)
+
+// RunEvaluation runs a test suite against one or two pipeline versions and returns the report
+func (s *Server) RunEvaluation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req EvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	keys, err := readProviderKeys(r)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.providerKeys, req.workspace = keys, workspaceOf(r)
+
+	evaluated := append([]AgentConfig{}, req.Baseline.Agents...)
+	if req.Candidate != nil {
+		evaluated = append(evaluated, req.Candidate.Agents...)
+	}
+	if req.Judge != nil {
+		evaluated = append(evaluated, *req.Judge)
+	}
+
+	run, err := s.prepareEvaluation(req)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: AUDIT_EVALUATION_RUN, Pipeline: req.Baseline.Name, Agents: auditAgents(evaluated), Detail: fmt.Sprintf("%d cases", len(req.Suite.Cases))})
+
+	report, err := run(r.Context())
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.sendJSON(w, http.StatusOK, report)
+}
+
+// Evaluate runs the suite of req outside the HTTP server, as the CLI does. It builds only
+// what the pipelines need: no cleanup goroutine, and no collections directory is created
+func Evaluate(ctx context.Context, req EvaluationRequest) (*eval.Report, error) {
+	s := &Server{
+		cache:      newCache(),
+		rag:        openRAGStore(),
+		secrets:    newSecretsStore(),
+		limits:     newProviderLimits(),
+		workspaces: newWorkspaceStore(),
+	}
+
+	run, err := s.prepareEvaluation(req)
+	if err != nil {
+		return nil, err
+	}
+	return run(ctx)
+}
+
+// prepareEvaluation validates req and returns the function that runs its suite
+func (s *Server) prepareEvaluation(req EvaluationRequest) (func(context.Context) (*eval.Report, error), error) {
+	if err := req.Suite.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid suite: %w", err)
+	}
+
+	// The CLI runs without a workspace
+	if req.workspace == "" {
+		req.workspace = DEFAULT_WORKSPACE
+	}
+
+	executionID := generateID(EVAL_PREFIX)
+	req.Baseline.providerKeys, req.Baseline.executionID, req.Baseline.workspace = req.providerKeys, executionID, req.workspace
+	if req.Candidate != nil {
+		req.Candidate.providerKeys, req.Candidate.executionID, req.Candidate.workspace = req.providerKeys, executionID, req.workspace
+	}
+
+	evaluator := &eval.Evaluator{}
+	if embedder, err := newEmbedder(); err == nil {
+		evaluator.Embedder = embedder
+	}
+
+	if req.Judge != nil {
+		// The judge answers in the verdict schema, so it cannot call tools or keep its own schema
+		judge := *req.Judge
+		judge.Tools, judge.OutputSchema = nil, nil
+		envVar, ok := shared.ProviderEnvVars[judge.Provider]
+		if !ok {
+			return nil, fmt.Errorf("judge provider '%s' is not supported", judge.Provider)
+		}
+		evaluator.NewJudge = func() (*agents.Agent, error) {
+			agent, err := s.newAgent(judge, envVar, ExecutePipelineRequest{providerKeys: req.providerKeys, executionID: executionID, workspace: req.workspace}, nil)
+			if err != nil {
+				return nil, err
+			}
+			agent.Verbose = false
+			return agent, nil
+		}
+	}
+
+	baseline, save, err := s.evaluationRunner(req.Baseline)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+
+	var candidate eval.RunFunc
+	saveCandidate := func() {}
+	if req.Candidate != nil {
+		candidate, saveCandidate, err = s.evaluationRunner(*req.Candidate)
+		if err != nil {
+			return nil, fmt.Errorf("candidate: %w", err)
+		}
+	}
+
+	return func(ctx context.Context) (*eval.Report, error) {
+		defer save()
+		defer saveCandidate()
+		return evaluator.Compare(ctx, req.Suite, baseline, candidate)
+	}, nil
+}
+
+// evaluationRunner runs a pipeline definition on each case with fresh agents;
+// save records its cassette once the evaluation is done
+func (s *Server) evaluationRunner(req ExecutePipelineRequest) (eval.RunFunc, func(), error) {
+	if len(req.Agents) == 0 {
+		return nil, nil, errors.New("at least one agent is required")
+	}
+
+	cassette, err := openCassette(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cassette unavailable: %w", err)
+	}
+	if _, err := s.newNestedManager(req, cassette); err != nil {
+		return nil, nil, err
+	}
+
+	run := func(input string) (string, error) {
+		manager, err := s.newNestedManager(req, cassette)
+		if err != nil {
+			return "", err
+		}
+		manager.FirstPrompt = input
+
+		output, err := manager.StartPipeline()
+		s.workspaces.record(req.workspace, manager.Usage())
+		if err != nil {
+			return "", err
+		}
+		return output.Text, nil
+	}
+	save := func() { saveCassette(req, cassette) }
+	return run, save, nil
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/AlexsanderHamir/PromptMesh/eval"
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+)
+
+func TestEvaluateCreatesNoCollectionsDirectory(t *testing.T) {
+	provider := &fakeOpenAI{}
+	server := httptest.NewServer(provider)
+	defer server.Close()
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Chdir(t.TempDir())
+
+	req := EvaluationRequest{
+		Suite: eval.Suite{Name: "smoke", Cases: []eval.Case{{Input: "Look it up"}}},
+		Baseline: ExecutePipelineRequest{Name: "lookup", Agents: []AgentConfig{
+			{Name: "search", Role: "assistant", SystemMsg: "Help.", Provider: shared.PROVIDER_OPENAI},
+		}},
+	}
+	report, err := Evaluate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Baseline.Passed != 1 || report.Cases[0].Baseline.Output != "found" {
+		t.Fatalf("got %+v, want the one case passed with output found", report.Baseline)
+	}
+
+	if _, err := os.Stat(DEFAULT_RAG_DIR); !os.IsNotExist(err) {
+		t.Fatalf("evaluating created the %s directory", DEFAULT_RAG_DIR)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/orchestration"
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+)
+
+// addGuardrails attaches the guardrails configured on a step to manager
+func (s *Server) addGuardrails(manager *orchestration.AgentManager, cfg AgentConfig, req ExecutePipelineRequest, cassette *agents.Cassette) error {
+	for _, guardrailConfig := range cfg.Guardrails {
+		guardrail, err := s.newGuardrail(guardrailConfig, req, cassette)
+		if err != nil {
+			return fmt.Errorf("guardrail '%s' on '%s': %w", guardrailConfig.Type, cfg.Name, err)
+		}
+		manager.AddGuardrail(cfg.Name, guardrail)
+	}
+	return nil
+}
+
+func (s *Server) newGuardrail(cfg GuardrailConfig, req ExecutePipelineRequest, cassette *agents.Cassette) (orchestration.Guardrail, error) {
+	guardrail := orchestration.Guardrail{Name: cfg.Type, Action: cfg.Action}
+	switch cfg.Action {
+	case "":
+		guardrail.Action = orchestration.ACTION_FAIL
+	case orchestration.ACTION_FAIL, orchestration.ACTION_REDACT, orchestration.ACTION_RETRY, orchestration.ACTION_WARN:
+	default:
+		return guardrail, fmt.Errorf("invalid action '%s', expected %s, %s, %s or %s", cfg.Action, orchestration.ACTION_FAIL, orchestration.ACTION_REDACT, orchestration.ACTION_RETRY, orchestration.ACTION_WARN)
+	}
+
+	switch cfg.Type {
+	case GUARDRAIL_DENY:
+		if len(cfg.Patterns) == 0 {
+			return guardrail, errors.New("patterns are required")
+		}
+		var deny orchestration.DenyList
+		for _, pattern := range cfg.Patterns {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return guardrail, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+			}
+			deny.Patterns = append(deny.Patterns, compiled)
+		}
+		guardrail.Validator = deny
+	case GUARDRAIL_PII:
+		guardrail.Validator = orchestration.PIIDetector{}
+	case GUARDRAIL_INJECTION:
+		guardrail.Validator = orchestration.InjectionDetector{}
+	case GUARDRAIL_MAX_LENGTH:
+		if cfg.MaxLength <= 0 {
+			return guardrail, errors.New("max_length must be positive")
+		}
+		guardrail.Validator = orchestration.MaxLength{Limit: cfg.MaxLength}
+	case GUARDRAIL_JSON:
+		var validator orchestration.JSONValidator
+		if len(cfg.Schema) > 0 {
+			if err := json.Unmarshal(cfg.Schema, &validator.Schema); err != nil {
+				return guardrail, fmt.Errorf("invalid schema: %w", err)
+			}
+		}
+		guardrail.Validator = validator
+	case GUARDRAIL_JUDGE:
+		if cfg.Judge == nil {
+			return guardrail, errors.New("judge agent is required")
+		}
+		envVar, ok := shared.ProviderEnvVars[cfg.Judge.Provider]
+		if !ok {
+			return guardrail, fmt.Errorf("provider '%s' is not supported", cfg.Judge.Provider)
+		}
+		judge := *cfg.Judge
+		judge.Tools, judge.OutputSchema = nil, nil
+		guardrail.Validator = orchestration.JudgeValidator{NewAgent: func() (*agents.Agent, error) {
+			agent, err := s.newAgent(judge, envVar, req, cassette)
+			if err != nil {
+				return nil, err
+			}
+			agent.Verbose = false
+			return agent, nil
+		}}
+	default:
+		return guardrail, fmt.Errorf("unknown guardrail type '%s'", cfg.Type)
+	}
+
+	return guardrail, nil
+}
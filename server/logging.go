@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging installs the default structured logger, which the log package writes through too.
+// Records go to stderr at info level in text unless level and format say otherwise.
+func setupLogging(level, format string) error {
+	var options slog.HandlerOptions
+	if level != "" {
+		var parsed slog.Level
+		if err := parsed.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level '%s', expected debug, info, warn or error", level)
+		}
+		options.Level = parsed
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "", LOG_FORMAT_TEXT:
+		handler = slog.NewTextHandler(os.Stderr, &options)
+	case LOG_FORMAT_JSON:
+		handler = slog.NewJSONHandler(os.Stderr, &options)
+	default:
+		return fmt.Errorf("unknown log format '%s', expected %s or %s", format, LOG_FORMAT_TEXT, LOG_FORMAT_JSON)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
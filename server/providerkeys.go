@@ -0,0 +1,31 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AlexsanderHamir/PromptMesh/shared"
+)
+
+// readProviderKeys collects the caller's own provider API keys from
+// "X-Provider-Key: <provider>=<key>" headers. The keys live only as long as the request.
+func readProviderKeys(r *http.Request) (map[string]string, error) {
+	var keys map[string]string
+	for _, header := range r.Header.Values(PROVIDER_KEY_HEADER) {
+		for _, entry := range strings.Split(header, ",") {
+			provider, key, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("%s must be formatted as <provider>=<key>", PROVIDER_KEY_HEADER)
+			}
+			if _, supported := shared.ProviderEnvVars[provider]; !supported {
+				return nil, fmt.Errorf("%s names unsupported provider '%s'", PROVIDER_KEY_HEADER, provider)
+			}
+			if keys == nil {
+				keys = make(map[string]string)
+			}
+			keys[provider] = key
+		}
+	}
+	return keys, nil
+}
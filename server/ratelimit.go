@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientLimits holds a token bucket per API key, or per IP when authentication is disabled,
+// and one per workspace with a quota
+type clientLimits struct {
+	rpm     int // per client; 0 disables
+	burst   int
+	clients map[string]*clientLimit
+	mutex   sync.Mutex
+}
+
+type clientLimit struct {
+	limiter  *rate.Limiter
+	rpm      int
+	lastSeen time.Time
+}
+
+// newClientLimits reads the per-client limits from the environment
+func newClientLimits() *clientLimits {
+	return &clientLimits{
+		rpm:     envInt(ENV_CLIENT_RPM, DEFAULT_CLIENT_RPM),
+		burst:   max(envInt(ENV_CLIENT_BURST, DEFAULT_CLIENT_BURST), 1),
+		clients: make(map[string]*clientLimit),
+	}
+}
+
+// reserve takes a token from the client's bucket, returning how long to wait for one instead;
+// a bucket follows changes to rpm, such as a new workspace quota
+func (cl *clientLimits) reserve(client string, rpm int) time.Duration {
+	cl.mutex.Lock()
+	limit, ok := cl.clients[client]
+	if !ok {
+		limit = &clientLimit{limiter: rate.NewLimiter(rate.Limit(float64(rpm)/60), min(cl.burst, rpm)), rpm: rpm}
+		cl.clients[client] = limit
+	}
+	if limit.rpm != rpm {
+		limit.limiter.SetLimit(rate.Limit(float64(rpm) / 60))
+		limit.limiter.SetBurst(min(cl.burst, rpm))
+		limit.rpm = rpm
+	}
+	limit.lastSeen = time.Now()
+	cl.mutex.Unlock()
+
+	reservation := limit.limiter.Reserve()
+	delay := reservation.Delay()
+	if delay > 0 {
+		reservation.Cancel()
+	}
+	return delay
+}
+
+// purge forgets clients idle since cutoff
+func (cl *clientLimits) purge(cutoff time.Time) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	for client, limit := range cl.clients {
+		if limit.lastSeen.Before(cutoff) {
+			delete(cl.clients, client)
+		}
+	}
+}
+
+// clientOf identifies the caller of r by API key, or by IP while authentication is disabled
+func clientOf(r *http.Request) string {
+	if key := requestKey(r); key != nil {
+		return "key:" + key.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limitRate rejects requests beyond the client's rate or its workspace's quota with 429 Too Many Requests
+func (s *Server) limitRate(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var delay time.Duration
+		if s.clients.rpm > 0 {
+			delay = s.clients.reserve(clientOf(r), s.clients.rpm)
+		}
+		if workspace, _ := s.workspaces.get(workspaceOf(r)); delay == 0 && workspace.RequestsPerMinute > 0 {
+			delay = s.clients.reserve("workspace:"+workspace.Name, workspace.RequestsPerMinute)
+		}
+
+		if delay > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			s.sendError(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded, retry in %s", delay.Round(time.Second)))
+			return
+		}
+
+		handler(w, r)
+	}
+}
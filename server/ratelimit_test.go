@@ -0,0 +1,18 @@
+package server
+
+import "testing"
+
+func TestClientLimitsFollowQuotaChanges(t *testing.T) {
+	limits := &clientLimits{burst: 10, clients: make(map[string]*clientLimit)}
+	if delay := limits.reserve("workspace:team-a", 60); delay != 0 {
+		t.Fatalf("first request waited %s", delay)
+	}
+
+	// Lowering the quota to 1 per minute also lowers the burst to 1
+	if delay := limits.reserve("workspace:team-a", 1); delay != 0 {
+		t.Fatalf("request within the new quota waited %s", delay)
+	}
+	if delay := limits.reserve("workspace:team-a", 1); delay == 0 {
+		t.Fatal("request beyond the new quota was allowed")
+	}
+}
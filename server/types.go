@@ -1,11 +1,16 @@
 package server
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
 
 	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+	"github.com/AlexsanderHamir/PromptMesh/eval"
 	"github.com/AlexsanderHamir/PromptMesh/orchestration"
+	"github.com/AlexsanderHamir/PromptMesh/rag"
+	"github.com/AlexsanderHamir/PromptMesh/secrets"
 )
 
 // Request/Response types for single pipeline execution
@@ -13,6 +18,56 @@ type ExecutePipelineRequest struct {
 	Name        string        `json:"name"`
 	FirstPrompt string        `json:"first_prompt"`
 	Agents      []AgentConfig `json:"agents"`
+
+	// Images are URLs of pictures handed to the first agent alongside first_prompt
+	Images []string `json:"images,omitempty"`
+
+	// Cache is one of bypass (default), read or write.
+	Cache string `json:"cache,omitempty"`
+
+	// Cassette names a recording of provider traffic; CassetteMode is record or replay.
+	Cassette     string `json:"cassette,omitempty"`
+	CassetteMode string `json:"cassette_mode,omitempty"`
+
+	// RedactPII replaces personal data with placeholders before prompts reach providers
+	RedactPII bool `json:"redact_pii,omitempty"`
+
+	// IsolateInputs wraps each agent's upstream input in a data block it is told not to take instructions from
+	IsolateInputs bool `json:"isolate_inputs,omitempty"`
+
+	// redactor holds the execution's placeholder mapping; nested pipelines share it
+	redactor *agents.Redactor
+
+	// providerKeys are the caller's own API keys by provider, used instead of the server's
+	providerKeys map[string]string
+
+	// executionID is recorded against the stored credentials the request uses
+	executionID string
+
+	// workspace owns the execution, its credentials, collections and cassettes
+	workspace string
+
+	// nested marks pipelines fed by another step rather than the caller, such as a
+	// sub-pipeline after the first step, a reducer or a pipeline tool, so isolation
+	// covers their first agent too
+	nested bool
+}
+
+// withRedactor gives the execution its own placeholder mapping when redaction is requested
+func (req ExecutePipelineRequest) withRedactor() ExecutePipelineRequest {
+	if req.RedactPII && req.redactor == nil {
+		req.redactor = agents.NewRedactor()
+	}
+	return req
+}
+
+// inheriting gives a nested pipeline the parent's cache, cassette, redaction, keys and workspace;
+// fed tells whether another step produces its input rather than the caller
+func (req ExecutePipelineRequest) inheriting(parent ExecutePipelineRequest, fed bool) ExecutePipelineRequest {
+	req.Cache, req.CassetteMode, req.redactor = parent.Cache, parent.CassetteMode, parent.redactor
+	req.providerKeys, req.executionID, req.workspace = parent.providerKeys, parent.executionID, parent.workspace
+	req.nested = fed
+	return req
 }
 
 type AgentConfig struct {
@@ -21,11 +76,199 @@ type AgentConfig struct {
 	SystemMsg string `json:"system_msg"`
 	Provider  string `json:"provider"`
 	Model     string `json:"model,omitempty"`
+
+	// Credential names a stored provider key to call the provider with
+	Credential string `json:"credential,omitempty"`
+
+	// OutputSchema is a JSON Schema the agent's response must satisfy.
+	OutputSchema  json.RawMessage `json:"output_schema,omitempty"`
+	OutputRetries *int            `json:"output_retries,omitempty"`
+
+	Tools []ToolConfig `json:"tools,omitempty"`
+
+	// Collection names a document collection whose top_k closest chunks are added to the prompt
+	Collection string `json:"collection,omitempty"`
+	TopK       int    `json:"top_k,omitempty"`
+
+	// RequiresApproval parks the pipeline after this agent until a human approves or rejects its output
+	RequiresApproval bool `json:"requires_approval,omitempty"`
+
+	// Pipeline makes this step run another pipeline definition instead of an LLM;
+	// only name is required alongside it
+	Pipeline *ExecutePipelineRequest `json:"pipeline,omitempty"`
+
+	// Map makes this step run an agent or pipeline over each item of the previous output
+	Map *MapConfig `json:"map,omitempty"`
+
+	// Guardrails validate this step's output before it is passed on
+	Guardrails []GuardrailConfig `json:"guardrails,omitempty"`
+}
+
+// isComposite reports whether the step runs nested pipelines instead of an LLM
+func (cfg AgentConfig) isComposite() bool {
+	return cfg.Pipeline != nil || cfg.Map != nil
+}
+
+// MapConfig splits the previous output into items, processes them concurrently and joins the results
+type MapConfig struct {
+	// Split is lines (default), json or regex; Separator is the regex used by regex
+	Split       string `json:"split,omitempty"`
+	Separator   string `json:"separator,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`
+
+	// Agent or Pipeline is run on every item
+	Agent    *AgentConfig            `json:"agent,omitempty"`
+	Pipeline *ExecutePipelineRequest `json:"pipeline,omitempty"`
+
+	// Join is text (default) or json; Reducer, when set, turns the joined results into the step's output
+	Join    string       `json:"join,omitempty"`
+	Reducer *AgentConfig `json:"reducer,omitempty"`
+}
+
+// GuardrailConfig checks a step's output and fails, redacts or retries it when it trips
+type GuardrailConfig struct {
+	// Type is one of deny, pii, injection, max_length, json or judge
+	Type string `json:"type"`
+
+	// Action is fail (default), redact, retry or warn
+	Action string `json:"action,omitempty"`
+
+	Patterns  []string        `json:"patterns,omitempty"`   // deny
+	MaxLength int             `json:"max_length,omitempty"` // max_length
+	Schema    json.RawMessage `json:"schema,omitempty"`     // json, optional
+	Judge     *AgentConfig    `json:"judge,omitempty"`      // judge; its system_msg states the policy
+}
+
+// ToolConfig declares a tool an agent's LLM may call
+type ToolConfig struct {
+	// Type is one of http_get, shell, calculator or pipeline
+	Type string `json:"type"`
+
+	// Name, Description and Pipeline apply to pipeline tools only
+	Name        string                  `json:"name,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Pipeline    *ExecutePipelineRequest `json:"pipeline,omitempty"`
 }
 
 type ExecutePipelineResponse struct {
 	Result  string `json:"result"`
 	Message string `json:"message"`
+
+	// Parts is set when the final output carries more than text, such as images
+	Parts []agents.Part `json:"parts,omitempty"`
+}
+
+// ApprovalRequest resolves an execution parked at an approval step; text optionally replaces the output
+type ApprovalRequest struct {
+	Decision string `json:"decision"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// APIKeyRequest creates an API key with the given scopes
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+
+	// Workspace defaults to the caller's; only operators may name another
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// APIKeyResponse describes an API key; Key holds the token only when the key is created
+type APIKeyResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Workspace string    `json:"workspace"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key,omitempty"`
+}
+
+// WorkspaceRequest creates a workspace; RequestsPerMinute, when set, is shared by all its keys
+type WorkspaceRequest struct {
+	Name              string `json:"name"`
+	RequestsPerMinute int    `json:"requests_per_minute,omitempty"`
+}
+
+// CredentialRequest creates (name, provider, key) or rotates (key) a stored credential
+type CredentialRequest struct {
+	Name     string `json:"name,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Key      string `json:"key"`
+}
+
+// CredentialResponse describes a stored credential without its key
+type CredentialResponse struct {
+	Name      string    `json:"name"`
+	Provider  string    `json:"provider"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+type CollectionResponse struct {
+	Name   string `json:"name"`
+	Chunks int    `json:"chunks"`
+}
+
+// BatchRequest runs a pipeline once per dataset row. FirstPrompt is a template
+// whose {{column}} placeholders are filled from the row; without it the row's
+// input column is the prompt.
+type BatchRequest struct {
+	ExecutePipelineRequest
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// BatchResult is the outcome of one dataset row
+type BatchResult struct {
+	Row              int    `json:"row"`
+	Input            string `json:"input"`
+	Output           string `json:"output"`
+	Error            string `json:"error,omitempty"`
+	LatencyMS        int64  `json:"latency_ms"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// Batch keeps the results of a batch run until they are cleaned up with the executions
+type Batch struct {
+	ID        string
+	Workspace string
+	Results   []BatchResult
+	CreatedAt time.Time
+}
+
+// EvaluationRequest runs a test suite on a baseline pipeline and, optionally, a candidate to compare it with
+type EvaluationRequest struct {
+	Suite     eval.Suite              `json:"suite"`
+	Baseline  ExecutePipelineRequest  `json:"baseline"`
+	Candidate *ExecutePipelineRequest `json:"candidate,omitempty"`
+
+	// Judge, when set, scores every output; its system message states the criteria
+	Judge *AgentConfig `json:"judge,omitempty"`
+
+	// providerKeys are the caller's own API keys by provider
+	providerKeys map[string]string
+
+	// workspace owns the evaluation
+	workspace string
+}
+
+// CompareRequest runs first_prompt through every variant side by side; each variant is
+// a pipeline whose name tags its events
+type CompareRequest struct {
+	Name        string                   `json:"name"`
+	FirstPrompt string                   `json:"first_prompt"`
+	Variants    []ExecutePipelineRequest `json:"variants"`
+}
+
+// VariantComparison summarizes one variant of a comparison run
+type VariantComparison struct {
+	Variant   string       `json:"variant"`
+	Result    string       `json:"result,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	LatencyMS int64        `json:"latency_ms"`
+	Usage     agents.Usage `json:"usage"`
 }
 
 type ErrorResponse struct {
@@ -37,19 +280,71 @@ type Server struct {
 	// Active pipeline executions (temporary, cleared after completion)
 	executions map[string]*PipelineExecution
 	mutex      sync.RWMutex
+
+	// Finished batch runs, kept for download
+	batches map[string]*Batch
+
+	// Shared LLM response cache, used by requests that opt in
+	cache agents.Cache
+
+	// Document collections for retrieval; nil when no embedder is configured
+	rag *rag.Store
+
+	// API keys; nil when authentication is disabled
+	keys *keyStore
+
+	// Encrypted provider credentials; nil when no master key is configured
+	secrets *secrets.Store
+
+	// Provider call limits shared by every agent, and request limits per client
+	limits  *agents.ProviderLimits
+	clients *clientLimits
+
+	// Tenants and their usage
+	workspaces *workspaceStore
+
+	// Record of who ran and changed what; nil when auditing is disabled
+	audit *audit.Log
 }
 
 // PipelineExecution represents a temporary execution session
 type PipelineExecution struct {
 	ID          string
+	Workspace   string
 	Name        string
 	FirstPrompt string
-	Manager     *orchestration.AgentManager
+	Manager     *orchestration.AgentManager // nil once the execution completes
 	Agents      []*agents.Agent
+	Attachments []Attachment
 	CreatedAt   time.Time
 	CompletedAt *time.Time
 	Result      *string
 	Error       *string
+	Cassette    *agents.Cassette
+}
+
+// status reports where the execution stands; callers hold the server lock
+func (e *PipelineExecution) status() string {
+	switch {
+	case e.Error != nil:
+		return STATUS_FAILED
+	case e.Result != nil:
+		return STATUS_SUCCEEDED
+	case e.Manager != nil && e.Manager.AwaitingApproval():
+		return STATUS_AWAITING_APPROVAL
+	}
+	return STATUS_RUNNING
+}
+
+// ExecutionResponse reports an execution's status and, once it finished, its result or error
+type ExecutionResponse struct {
+	ExecutionID string     `json:"execution_id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Result      *string    `json:"result,omitempty"`
+	Error       *string    `json:"error,omitempty"`
 }
 
 // Cleanup old executions (older than 1 hour)
@@ -63,4 +358,10 @@ func (s *Server) cleanupOldExecutions() {
 			delete(s.executions, id)
 		}
 	}
+	for id, batch := range s.batches {
+		if batch.CreatedAt.Before(cutoff) {
+			delete(s.batches, id)
+		}
+	}
+	s.clients.purge(cutoff)
 }
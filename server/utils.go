@@ -1,13 +1,23 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/rag"
+	"github.com/AlexsanderHamir/PromptMesh/secrets"
 	"github.com/AlexsanderHamir/PromptMesh/shared"
 	"github.com/google/uuid"
+	"github.com/tmc/langchaingo/embeddings"
 )
 
 // Utility functions
@@ -34,3 +44,186 @@ func getSupportedProviders() string {
 	}
 	return strings.Join(providers, ", ")
 }
+
+// newCache builds the response cache from the environment, preferring disk when configured
+func newCache() agents.Cache {
+	ttl := DEFAULT_CACHE_TTL
+	if raw := os.Getenv(ENV_CACHE_TTL); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Printf("invalid %s %q, using %s", ENV_CACHE_TTL, raw, ttl)
+		} else {
+			ttl = parsed
+		}
+	}
+
+	if dir := os.Getenv(ENV_CACHE_DIR); dir != "" {
+		cache, err := agents.NewDiskCache(dir, ttl)
+		if err == nil {
+			return cache
+		}
+		log.Printf("disk cache unavailable (%v), falling back to memory", err)
+	}
+
+	return agents.NewMemoryCache(ttl)
+}
+
+// cassettePath keeps cassette names inside the cassette directory, in a
+// subdirectory per workspace other than the default one
+func cassettePath(workspace, name string) string {
+	dir := os.Getenv(ENV_CASSETTE_DIR)
+	if dir == "" {
+		dir = DEFAULT_CASSETTE_DIR
+	}
+	if workspace != DEFAULT_WORKSPACE {
+		dir = filepath.Join(dir, workspace)
+	}
+	return filepath.Join(dir, filepath.Base(name)+".json")
+}
+
+// openCassette prepares the cassette a request asks for, or nil when none is requested
+func openCassette(req ExecutePipelineRequest) (*agents.Cassette, error) {
+	if req.Cassette == "" {
+		return nil, nil
+	}
+
+	switch req.CassetteMode {
+	case agents.CASSETTE_RECORD:
+		return agents.NewCassette(), nil
+	case agents.CASSETTE_REPLAY:
+		return agents.LoadCassette(cassettePath(req.workspace, req.Cassette))
+	}
+	return nil, fmt.Errorf("invalid cassette mode '%s', expected %s or %s", req.CassetteMode, agents.CASSETTE_RECORD, agents.CASSETTE_REPLAY)
+}
+
+// saveCassette persists a recording, including the calls of a failed run
+func saveCassette(req ExecutePipelineRequest, cassette *agents.Cassette) {
+	if cassette == nil || req.CassetteMode != agents.CASSETTE_RECORD {
+		return
+	}
+
+	path := cassettePath(req.workspace, req.Cassette)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("failed to create cassette dir: %v", err)
+		return
+	}
+	if err := cassette.Save(path); err != nil {
+		log.Printf("failed to save cassette %s: %v", path, err)
+	}
+}
+
+// envList reads a comma-separated environment variable, skipping empty entries
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envInt reads a non-negative integer environment variable, falling back to fallback
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("invalid %s %q, using %d", name, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// envProviderInts reads provider=n pairs from a comma-separated environment variable
+func envProviderInts(name string) map[string]int {
+	values := make(map[string]int)
+	for _, entry := range envList(name) {
+		provider, raw, _ := strings.Cut(entry, "=")
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || value <= 0 {
+			log.Printf("ignoring invalid %s entry %q", name, entry)
+			continue
+		}
+		values[strings.TrimSpace(provider)] = value
+	}
+	return values
+}
+
+// newProviderLimits builds the per-provider call limits shared by every agent
+func newProviderLimits() *agents.ProviderLimits {
+	return &agents.ProviderLimits{
+		Concurrency:       envProviderInts(ENV_PROVIDER_CONCURRENCY),
+		RequestsPerMinute: envProviderInts(ENV_PROVIDER_RPM),
+	}
+}
+
+// newEmbedder builds the embedder configured by the environment, defaulting to openai
+func newEmbedder() (embeddings.Embedder, error) {
+	provider := os.Getenv(ENV_EMBEDDING_PROVIDER)
+	if provider == "" {
+		provider = shared.PROVIDER_OPENAI
+	}
+	return agents.NewEmbedder(provider, shared.ProviderEnvVars[provider], os.Getenv(ENV_EMBEDDING_MODEL))
+}
+
+// newRAGStore opens the document store, or returns nil when embeddings are unavailable
+func newRAGStore() *rag.Store {
+	embedder, err := newEmbedder()
+	if err != nil {
+		log.Printf("document collections disabled: %v", err)
+		return nil
+	}
+
+	store, err := rag.NewStore(ragDir(), embedder)
+	if err != nil {
+		log.Printf("document collections disabled: %v", err)
+		return nil
+	}
+	return store
+}
+
+// openRAGStore opens the document store only when its directory already exists,
+// for runs that read collections but must not create them
+func openRAGStore() *rag.Store {
+	if _, err := os.Stat(ragDir()); err != nil {
+		return nil
+	}
+	return newRAGStore()
+}
+
+// ragDir is where document collections are stored
+func ragDir() string {
+	if dir := os.Getenv(ENV_RAG_DIR); dir != "" {
+		return dir
+	}
+	return DEFAULT_RAG_DIR
+}
+
+// newSecretsStore opens the credentials store, or returns nil when no master key is configured
+func newSecretsStore() *secrets.Store {
+	encoded := os.Getenv(ENV_MASTER_KEY)
+	if encoded == "" {
+		return nil
+	}
+
+	masterKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.Printf("stored credentials disabled: %s is not base64", ENV_MASTER_KEY)
+		return nil
+	}
+
+	dir := os.Getenv(ENV_SECRETS_DIR)
+	if dir == "" {
+		dir = DEFAULT_SECRETS_DIR
+	}
+
+	store, err := secrets.NewStore(dir, masterKey)
+	if err != nil {
+		log.Printf("stored credentials disabled: %v", err)
+		return nil
+	}
+	return store
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexsanderHamir/PromptMesh/agents"
+	"github.com/AlexsanderHamir/PromptMesh/audit"
+)
+
+// Workspace isolates one team's executions, credentials, collections, cassettes and quota
+type Workspace struct {
+	Name string `json:"name"`
+
+	// RequestsPerMinute caps the execution requests of all the workspace's keys together; 0 is unlimited
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	Usage     WorkspaceUsage `json:"usage"`
+}
+
+// WorkspaceUsage totals the pipeline runs of a workspace and the tokens they spent
+type WorkspaceUsage struct {
+	Executions int `json:"executions"`
+	agents.Usage
+}
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+var errWorkspaceExists = errors.New("workspace already exists")
+
+// workspaceStore holds the workspaces, persisted as a JSON file when one is configured
+type workspaceStore struct {
+	path       string
+	workspaces map[string]*Workspace
+	mutex      sync.RWMutex
+}
+
+// newWorkspaceStore loads the workspaces file named by the environment; the default workspace always exists
+func newWorkspaceStore() *workspaceStore {
+	store := &workspaceStore{path: os.Getenv(ENV_WORKSPACES_FILE), workspaces: make(map[string]*Workspace)}
+
+	if store.path != "" {
+		data, err := os.ReadFile(store.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("failed to read %s: %v", store.path, err)
+		}
+		if err == nil {
+			var workspaces []*Workspace
+			if err := json.Unmarshal(data, &workspaces); err != nil {
+				log.Fatalf("invalid workspaces file %s: %v", store.path, err)
+			}
+			for _, workspace := range workspaces {
+				store.workspaces[workspace.Name] = workspace
+			}
+		}
+	}
+
+	if _, ok := store.workspaces[DEFAULT_WORKSPACE]; !ok {
+		store.workspaces[DEFAULT_WORKSPACE] = &Workspace{Name: DEFAULT_WORKSPACE, CreatedAt: time.Now()}
+	}
+	return store
+}
+
+func (ws *workspaceStore) get(name string) (Workspace, bool) {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+
+	workspace, ok := ws.workspaces[name]
+	if !ok {
+		return Workspace{}, false
+	}
+	return *workspace, true
+}
+
+func (ws *workspaceStore) create(name string, requestsPerMinute int) (Workspace, error) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	if _, ok := ws.workspaces[name]; ok {
+		return Workspace{}, errWorkspaceExists
+	}
+
+	workspace := &Workspace{Name: name, RequestsPerMinute: requestsPerMinute, CreatedAt: time.Now()}
+	ws.workspaces[name] = workspace
+	if err := ws.save(); err != nil {
+		delete(ws.workspaces, name)
+		return Workspace{}, err
+	}
+	return *workspace, nil
+}
+
+func (ws *workspaceStore) list() []Workspace {
+	ws.mutex.RLock()
+	defer ws.mutex.RUnlock()
+
+	workspaces := make([]Workspace, 0, len(ws.workspaces))
+	for _, workspace := range ws.workspaces {
+		workspaces = append(workspaces, *workspace)
+	}
+	slices.SortFunc(workspaces, func(a, b Workspace) int { return strings.Compare(a.Name, b.Name) })
+	return workspaces
+}
+
+// record adds one pipeline run and its token usage to a workspace
+func (ws *workspaceStore) record(name string, usage agents.Usage) {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	workspace, ok := ws.workspaces[name]
+	if !ok {
+		return
+	}
+	workspace.Usage.Executions++
+	workspace.Usage.Add(usage)
+	if err := ws.save(); err != nil {
+		log.Printf("failed to save workspace usage: %v", err)
+	}
+}
+
+// save writes the workspaces file, if any; callers hold the write lock
+func (ws *workspaceStore) save() error {
+	if ws.path == "" {
+		return nil
+	}
+
+	workspaces := make([]*Workspace, 0, len(ws.workspaces))
+	for _, workspace := range ws.workspaces {
+		workspaces = append(workspaces, workspace)
+	}
+	data, err := json.MarshalIndent(workspaces, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ws.path, data, 0o600)
+}
+
+// collectionName is the name a workspace's collection is stored under;
+// the default workspace keeps plain names so existing collections stay reachable
+func collectionName(workspace, name string) string {
+	if workspace == DEFAULT_WORKSPACE {
+		return name
+	}
+	return workspace + WORKSPACE_SEPARATOR + name
+}
+
+// workspaceCache is the part of the shared response cache a workspace reads and writes;
+// the default workspace keeps plain keys so existing entries stay reachable
+func workspaceCache(cache agents.Cache, workspace string) agents.Cache {
+	if workspace == DEFAULT_WORKSPACE || workspace == "" {
+		return cache
+	}
+	return agents.ScopedCache(cache, workspace)
+}
+
+// ManageWorkspaces lists workspaces with their usage (GET) or creates one (POST); operators only
+func (s *Server) ManageWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if !isOperator(r) {
+		s.sendError(w, http.StatusForbidden, fmt.Sprintf("Only admin keys of the '%s' workspace manage workspaces", DEFAULT_WORKSPACE))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.sendJSON(w, http.StatusOK, s.workspaces.list())
+
+	case http.MethodPost:
+		var req WorkspaceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if !workspaceNamePattern.MatchString(req.Name) {
+			s.sendError(w, http.StatusBadRequest, "Workspace name must be lowercase letters, digits, '-' or '_'")
+			return
+		}
+		if req.RequestsPerMinute < 0 {
+			s.sendError(w, http.StatusBadRequest, "requests_per_minute cannot be negative")
+			return
+		}
+
+		workspace, err := s.workspaces.create(req.Name, req.RequestsPerMinute)
+		if errors.Is(err, errWorkspaceExists) {
+			s.sendError(w, http.StatusConflict, fmt.Sprintf("Workspace '%s' already exists", req.Name))
+			return
+		}
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create workspace: %v", err))
+			return
+		}
+		entry := audit.Entry{Action: AUDIT_WORKSPACE_CREATE, Target: workspace.Name}
+		if workspace.RequestsPerMinute > 0 {
+			entry.Detail = fmt.Sprintf("%d requests per minute", workspace.RequestsPerMinute)
+		}
+		s.recordAudit(r, entry)
+		s.sendJSON(w, http.StatusCreated, workspace)
+
+	default:
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// WorkspaceUsage returns a workspace's quota and usage to its own keys and to operators
+func (s *Server) WorkspaceUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := r.PathValue("name")
+	workspace, ok := s.workspaces.get(name)
+	if !ok || (name != workspaceOf(r) && !isOperator(r)) {
+		s.sendError(w, http.StatusNotFound, fmt.Sprintf("Workspace '%s' not found", name))
+		return
+	}
+	s.sendJSON(w, http.StatusOK, workspace)
+}
@@ -31,3 +31,47 @@ var DefaultModels = map[string]string{
 	PROVIDER_COHERE:      DEFAULT_MODEL_COHERE,
 	PROVIDER_HUGGINGFACE: DEFAULT_MODEL_HUGGINGFACE,
 }
+
+// JSONModeProviders support constraining responses to valid JSON.
+var JSONModeProviders = map[string]bool{
+	PROVIDER_OPENAI:   true,
+	PROVIDER_GOOGLEAI: true,
+}
+
+const (
+	DEFAULT_EMBEDDING_MODEL_OPENAI      = "text-embedding-3-small"
+	DEFAULT_EMBEDDING_MODEL_GOOGLEAI    = "embedding-001"
+	DEFAULT_EMBEDDING_MODEL_HUGGINGFACE = "sentence-transformers/all-MiniLM-L6-v2"
+)
+
+// DefaultEmbeddingModels lists the providers that can embed documents.
+var DefaultEmbeddingModels = map[string]string{
+	PROVIDER_OPENAI:      DEFAULT_EMBEDDING_MODEL_OPENAI,
+	PROVIDER_GOOGLEAI:    DEFAULT_EMBEDDING_MODEL_GOOGLEAI,
+	PROVIDER_HUGGINGFACE: DEFAULT_EMBEDDING_MODEL_HUGGINGFACE,
+}
+
+// VisionProviders accept images as part of the prompt.
+var VisionProviders = map[string]bool{
+	PROVIDER_OPENAI:    true,
+	PROVIDER_ANTHROPIC: true,
+	PROVIDER_GOOGLEAI:  true,
+}
+
+// ModelPrice is what a model charges in USD per million tokens.
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// ModelPrices lists list prices used to estimate run costs; unlisted models count as free.
+var ModelPrices = map[string]ModelPrice{
+	DEFAULT_MODEL_OPENAI:      {Prompt: 30, Completion: 60},
+	"gpt-4o":                  {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":             {Prompt: 0.15, Completion: 0.6},
+	DEFAULT_MODEL_ANTHROPIC:   {Prompt: 3, Completion: 15},
+	"claude-3-haiku-20240307": {Prompt: 0.25, Completion: 1.25},
+	"claude-3-opus-20240229":  {Prompt: 15, Completion: 75},
+	DEFAULT_MODEL_GOOGLEAI:    {Prompt: 0.5, Completion: 1.5},
+	DEFAULT_MODEL_COHERE:      {Prompt: 1, Completion: 2},
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	TOOL_HTTP_GET   = "http_get"
+	TOOL_SHELL      = "shell"
+	TOOL_CALCULATOR = "calculator"
+	TOOL_PIPELINE   = "pipeline"
+)
+
+const (
+	// MAX_TOOL_OUTPUT caps what a single tool call hands back to the model.
+	MAX_TOOL_OUTPUT = 64 * 1024
+	TOOL_TIMEOUT    = 30 * time.Second
+)
+
+// decodeArgs unmarshals the JSON arguments the model produced for a call.
+func decodeArgs(arguments string, v any) error {
+	if err := json.Unmarshal([]byte(arguments), v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func truncate(s string) string {
+	if len(s) <= MAX_TOOL_OUTPUT {
+		return s
+	}
+	return s[:MAX_TOOL_OUTPUT] + "\n[truncated]"
+}
+
+// HTTPGet fetches URLs whose host is on the allowlist.
+type HTTPGet struct {
+	AllowedHosts []string
+}
+
+func (t *HTTPGet) Definition() llms.FunctionDefinition {
+	return llms.FunctionDefinition{
+		Name:        TOOL_HTTP_GET,
+		Description: "Fetch a URL with HTTP GET and return the response body.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"url": map[string]any{"type": "string", "description": "Absolute http(s) URL"},
+			},
+			"required": []string{"url"},
+		},
+	}
+}
+
+func (t *HTTPGet) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+	if err := decodeArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(args.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return "", fmt.Errorf("invalid url '%s'", args.URL)
+	}
+	if !slices.Contains(t.AllowedHosts, target.Hostname()) {
+		return "", fmt.Errorf("host '%s' is not allowed", target.Hostname())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, TOOL_TIMEOUT)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	// Redirects could leave the allowlist, so they are returned instead of followed.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MAX_TOOL_OUTPUT+1))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("status: %d\n\n%s", resp.StatusCode, truncate(string(body))), nil
+}
+
+// Shell runs allowlisted commands directly, without a shell, so arguments cannot chain commands.
+type Shell struct {
+	AllowedCommands []string
+}
+
+func (t *Shell) Definition() llms.FunctionDefinition {
+	return llms.FunctionDefinition{
+		Name:        TOOL_SHELL,
+		Description: fmt.Sprintf("Run a local command and return its combined output. Allowed commands: %v.", t.AllowedCommands),
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{"type": "string"},
+				"args":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+			"required": []string{"command"},
+		},
+	}
+}
+
+func (t *Shell) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Command string   `json:"command"`
+		Args    []string `json:"args"`
+	}
+	if err := decodeArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(t.AllowedCommands, args.Command) {
+		return "", fmt.Errorf("command '%s' is not allowed", args.Command)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, TOOL_TIMEOUT)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args.Command, args.Args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, truncate(string(out)))
+	}
+	return truncate(string(out)), nil
+}
+
+// Calculator evaluates arithmetic expressions.
+type Calculator struct{}
+
+func (t *Calculator) Definition() llms.FunctionDefinition {
+	return llms.FunctionDefinition{
+		Name:        TOOL_CALCULATOR,
+		Description: "Evaluate an arithmetic expression with + - * / and parentheses.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"expression": map[string]any{"type": "string"},
+			},
+			"required": []string{"expression"},
+		},
+	}
+}
+
+func (t *Calculator) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArgs(arguments, &args); err != nil {
+		return "", err
+	}
+
+	result, err := Evaluate(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(result), nil
+}
+
+// Pipeline exposes another pipeline as a tool; Run executes it with the given input.
+type Pipeline struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, input string) (string, error)
+}
+
+func (t *Pipeline) Definition() llms.FunctionDefinition {
+	return llms.FunctionDefinition{
+		Name:        t.Name,
+		Description: t.Description,
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"input": map[string]any{"type": "string", "description": "Prompt for the pipeline's first agent"},
+			},
+			"required": []string{"input"},
+		},
+	}
+}
+
+func (t *Pipeline) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Input string `json:"input"`
+	}
+	if err := decodeArgs(arguments, &args); err != nil {
+		return "", err
+	}
+	if args.Input == "" {
+		return "", errors.New("input is required")
+	}
+	return t.Run(ctx, args.Input)
+}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Evaluate computes an arithmetic expression with + - * /, unary minus and parentheses.
+func Evaluate(expression string) (float64, error) {
+	p := &parser{input: strings.ReplaceAll(expression, " ", "")}
+
+	result, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.input) {
+		return 0, fmt.Errorf("unexpected '%c' at position %d", p.input[p.pos], p.pos)
+	}
+	return result, nil
+}
+
+// parser is a recursive descent parser over the grammar:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = factor { ("*" | "/") factor }
+//	factor     = "-" factor | "(" expression ")" | number
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expression() (float64, error) {
+	left, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+
+	for p.peek() == '+' || p.peek() == '-' {
+		op := p.peek()
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (float64, error) {
+	left, err := p.factor()
+	if err != nil {
+		return 0, err
+	}
+
+	for p.peek() == '*' || p.peek() == '/' {
+		op := p.peek()
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return 0, err
+		}
+		if op == '*' {
+			left *= right
+		} else if right == 0 {
+			return 0, errors.New("division by zero")
+		} else {
+			left /= right
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) factor() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.factor()
+		return -value, err
+	case '(':
+		p.pos++
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, fmt.Errorf("expected a number at position %d", start)
+	}
+	return strconv.ParseFloat(p.input[start:p.pos], 64)
+}
@@ -0,0 +1,43 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+		wantErr    string
+	}{
+		{expression: "1 + 2 * 3", want: 7},
+		{expression: "(1 + 2) * 3", want: 9},
+		{expression: "10 - 4 - 3", want: 3},
+		{expression: "8 / 4 / 2", want: 1},
+		{expression: "-(2 + 3) * -2", want: 10},
+		{expression: "0.5 * 3", want: 1.5},
+		{expression: "1 / 0", wantErr: "division by zero"},
+		{expression: "(1 + 2", wantErr: "missing closing parenthesis"},
+		{expression: "2 +", wantErr: "expected a number at position 2"},
+		{expression: "2 ^ 3", wantErr: "unexpected '^' at position 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := Evaluate(tt.expression)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v and error %v, want %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by Setup.
+const (
+	EXPORTER_NONE   = "none"
+	EXPORTER_OTLP   = "otlp"
+	EXPORTER_STDOUT = "stdout"
+	EXPORTER_FILE   = "file"
+)
+
+const SERVICE_NAME = "promptmesh"
+
+// Tracer creates the spans of requests, pipeline steps and provider calls.
+// It does nothing until Setup installs an exporter.
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/AlexsanderHamir/PromptMesh")
+}
+
+// Setup installs the global tracer provider. OTLP spans are sent over HTTP to
+// endpoint, or to the OTEL_EXPORTER_OTLP_* defaults when it is empty; stdout and
+// file exporters write one JSON span per line, the latter appending to path.
+func Setup(exporter, endpoint, path string) error {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case "", EXPORTER_NONE:
+		return nil
+	case EXPORTER_OTLP:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), options...)
+	case EXPORTER_STDOUT:
+		spanExporter, err = stdouttrace.New()
+	case EXPORTER_FILE:
+		if path == "" {
+			return fmt.Errorf("the %s exporter needs a file path", EXPORTER_FILE)
+		}
+		file, openErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if openErr != nil {
+			return openErr
+		}
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return fmt.Errorf("unknown trace exporter '%s', expected %s, %s or %s", exporter, EXPORTER_OTLP, EXPORTER_STDOUT, EXPORTER_FILE)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Local exporters write each span as it ends so nothing is lost when the process stops
+	processor := sdktrace.WithSyncer(spanExporter)
+	if exporter == EXPORTER_OTLP {
+		processor = sdktrace.WithBatcher(spanExporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", SERVICE_NAME)))
+	if err != nil {
+		return err
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(processor, sdktrace.WithResource(res)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return nil
+}
+
+// StartRequest starts the root span of an HTTP request, continuing the caller's
+// trace when the request carries a traceparent header.
+func StartRequest(r *http.Request, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}